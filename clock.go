@@ -0,0 +1,87 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import "time"
+
+// Clock is the source of time of a connection. It is used for the reconnect
+// waits, the ping timer, the request and flush timeouts and the JetStream
+// heartbeat checks, so that tests can control the passing of time, see the
+// SetClock() option. Network deadlines and contexts still use the wall clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a timer sending the current time on its channel
+	// after the duration.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc returns a timer calling f in its own goroutine after the
+	// duration.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer created by a Clock, behaving like a *time.Timer.
+type Timer interface {
+	// C returns the channel of the timer, nil for timers created with
+	// AfterFunc.
+	C() <-chan time.Time
+	// Reset changes the timer to expire after the duration.
+	Reset(d time.Duration) bool
+	// Stop prevents the timer from firing.
+	Stop() bool
+}
+
+// systemClock is the Clock used by default, based on the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return sysTimer{time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return sysTimer{time.AfterFunc(d, f)}
+}
+
+type sysTimer struct {
+	*time.Timer
+}
+
+func (t sysTimer) C() <-chan time.Time { return t.Timer.C }
+
+// clock returns the Clock of the options.
+func (o *Options) clock() Clock {
+	if o.Clock == nil {
+		return systemClock{}
+	}
+	return o.Clock
+}
+
+// getTimer returns a timer expiring after the duration, from the timer pool
+// when the system clock is used. It should be released with putTimer.
+func (nc *Conn) getTimer(d time.Duration) Timer {
+	if nc.Opts.Clock == nil {
+		return sysTimer{globalTimerPool.Get(d)}
+	}
+	return nc.Opts.Clock.NewTimer(d)
+}
+
+// putTimer releases a timer obtained with getTimer.
+func (nc *Conn) putTimer(t Timer) {
+	if st, ok := t.(sysTimer); ok {
+		globalTimerPool.Put(st.Timer)
+		return
+	}
+	t.Stop()
+}
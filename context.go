@@ -18,6 +18,31 @@ import (
 	"reflect"
 )
 
+// PublishWithContext publishes the data argument to the given subject. With
+// the PublishBackpressure() option, it blocks until the outbound buffer falls
+// below the high-water mark or the context is done.
+func (nc *Conn) PublishWithContext(ctx context.Context, subj string, data []byte) error {
+	if ctx == nil {
+		return ErrInvalidContext
+	}
+	return nc.publishWithContext(ctx, subj, _EMPTY_, nil, data)
+}
+
+// PublishMsgWithContext publishes the Msg structure, see PublishWithContext().
+func (nc *Conn) PublishMsgWithContext(ctx context.Context, m *Msg) error {
+	if ctx == nil {
+		return ErrInvalidContext
+	}
+	if m == nil {
+		return ErrInvalidMsg
+	}
+	hdr, err := m.headerBytes()
+	if err != nil {
+		return err
+	}
+	return nc.publishWithContext(ctx, m.Subject, m.Reply, hdr, m.Data)
+}
+
 // RequestMsgWithContext takes a context, a subject and payload
 // in bytes and request expecting a single response.
 func (nc *Conn) RequestMsgWithContext(ctx context.Context, msg *Msg) (*Msg, error) {
@@ -0,0 +1,182 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ConnEventType is the type of a connection event.
+type ConnEventType int
+
+const (
+	// ConnEventDisconnected is sent when the connection to the server is lost.
+	ConnEventDisconnected ConnEventType = iota
+	// ConnEventReconnected is sent when the connection is reestablished.
+	ConnEventReconnected
+	// ConnEventClosed is sent when the connection is closed. It is the last
+	// event of a connection.
+	ConnEventClosed
+	// ConnEventDiscoveredServers is sent when new servers are discovered.
+	ConnEventDiscoveredServers
+	// ConnEventLameDuckMode is sent when the server enters lame duck mode.
+	ConnEventLameDuckMode
+	// ConnEventError is sent for the errors reported to the ErrorHandler.
+	ConnEventError
+)
+
+func (t ConnEventType) String() string {
+	switch t {
+	case ConnEventDisconnected:
+		return "Disconnected"
+	case ConnEventReconnected:
+		return "Reconnected"
+	case ConnEventClosed:
+		return "Closed"
+	case ConnEventDiscoveredServers:
+		return "DiscoveredServers"
+	case ConnEventLameDuckMode:
+		return "LameDuckMode"
+	case ConnEventError:
+		return "Error"
+	default:
+		return "Unknown"
+	}
+}
+
+// ConnEvent is an event of the lifecycle of a connection.
+type ConnEvent struct {
+	Type ConnEventType
+	// Time of the event, from the Clock of the connection.
+	Time time.Time
+	// Server is the URL of the server, without credentials, if any.
+	Server string
+	// Err is the error of the event, if any.
+	Err error
+	// Sub is the subscription an error relates to, if any.
+	Sub *Subscription
+}
+
+// ConnEventSubscription is the registration of a channel receiving the events
+// of a connection, see Conn.SubscribeEvents().
+type ConnEventSubscription struct {
+	nc      *Conn
+	ch      chan<- ConnEvent
+	types   map[ConnEventType]struct{}
+	dropped uint64
+}
+
+// SubscribeEvents registers ch to receive the events of the connection, of
+// the given types or of all types if none is given. Any number of channels
+// can be registered, in addition to the callbacks set in the Options.
+//
+// Events are sent from the goroutine dispatching the asynchronous callbacks,
+// in the same order. They are not waited for: if ch is full, the event is
+// dropped, so ch should be buffered. The channel is not closed by the
+// library.
+func (nc *Conn) SubscribeEvents(ch chan<- ConnEvent, types ...ConnEventType) (*ConnEventSubscription, error) {
+	if nc == nil {
+		return nil, ErrInvalidConnection
+	}
+	if ch == nil {
+		return nil, ErrChanArg
+	}
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if nc.isClosed() {
+		return nil, ErrConnectionClosed
+	}
+	es := &ConnEventSubscription{nc: nc, ch: ch}
+	if len(types) > 0 {
+		es.types = make(map[ConnEventType]struct{}, len(types))
+		for _, t := range types {
+			es.types[t] = struct{}{}
+		}
+	}
+	nc.evMu.Lock()
+	if nc.evSubs == nil {
+		nc.evSubs = make(map[*ConnEventSubscription]struct{})
+	}
+	nc.evSubs[es] = struct{}{}
+	nc.evMu.Unlock()
+	return es, nil
+}
+
+// Unsubscribe stops sending events to the channel.
+func (es *ConnEventSubscription) Unsubscribe() {
+	nc := es.nc
+	nc.evMu.Lock()
+	delete(nc.evSubs, es)
+	nc.evMu.Unlock()
+}
+
+// Dropped returns the number of events dropped because the channel was full.
+func (es *ConnEventSubscription) Dropped() uint64 {
+	return atomic.LoadUint64(&es.dropped)
+}
+
+func (es *ConnEventSubscription) deliver(ev ConnEvent) {
+	if es.types != nil {
+		if _, ok := es.types[ev.Type]; !ok {
+			return
+		}
+	}
+	es.nc.evMu.Lock()
+	_, active := es.nc.evSubs[es]
+	es.nc.evMu.Unlock()
+	if !active {
+		return
+	}
+	select {
+	case es.ch <- ev:
+	default:
+		atomic.AddUint64(&es.dropped, 1)
+	}
+}
+
+// pushEvent queues the event for the registered channels.
+// Connection lock is held on entry.
+func (nc *Conn) pushEvent(typ ConnEventType, err error, sub *Subscription) {
+	nc.evMu.Lock()
+	if len(nc.evSubs) == 0 {
+		nc.evMu.Unlock()
+		return
+	}
+	subs := make([]*ConnEventSubscription, 0, len(nc.evSubs))
+	for es := range nc.evSubs {
+		subs = append(subs, es)
+	}
+	nc.evMu.Unlock()
+
+	ev := ConnEvent{Type: typ, Time: nc.Opts.clock().Now(), Err: err, Sub: sub}
+	if nc.current != nil && nc.current.url != nil {
+		ev.Server = nc.current.url.Redacted()
+	}
+	nc.ach.push(func() {
+		for _, es := range subs {
+			es.deliver(ev)
+		}
+	})
+}
+
+// pushAsyncErr queues the error for the ErrorHandler and the registered
+// channels.
+// Connection lock is held on entry.
+func (nc *Conn) pushAsyncErr(sub *Subscription, err error) {
+	if errCB := nc.Opts.AsyncErrorCB; errCB != nil {
+		nc.ach.push(func() { errCB(nc, sub, err) })
+	}
+	nc.pushEvent(ConnEventError, err, sub)
+}
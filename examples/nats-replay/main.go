@@ -0,0 +1,94 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NOTE: Replays a capture made with the nats.CaptureProtocol() option.
+// nats-replay [-v] <capture file>
+
+func usage() {
+	log.Printf("Usage: nats-replay [-v] <capture file>\n")
+	flag.PrintDefaults()
+}
+
+func showUsageAndExit(exitcode int) {
+	usage()
+	os.Exit(exitcode)
+}
+
+func main() {
+	var verbose = flag.Bool("v", false, "Display the frames of the capture")
+	var showHelp = flag.Bool("h", false, "Show help message")
+
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showHelp {
+		showUsageAndExit(0)
+	}
+
+	args := flag.Args()
+	if len(args) != 1 {
+		showUsageAndExit(1)
+	}
+
+	if *verbose {
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		cr := nats.NewCaptureReader(f)
+		for {
+			frame, err := cr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			dir := "<<-"
+			if frame.Outbound {
+				dir = "->>"
+			}
+			log.Printf("%s %s %q", frame.Time.Format(time.RFC3339Nano), dir, frame.Data)
+		}
+		f.Close()
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	i := 0
+	err = nats.ReplayCapture(f, func(m *nats.Msg) {
+		i++
+		log.Printf("[#%d] Received on [%s]: '%s'", i, m.Subject, string(m.Data))
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Replayed %d messages", i)
+}
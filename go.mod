@@ -5,7 +5,7 @@ go 1.16
 require (
 	github.com/go-stack/stack v1.8.1 // indirect
 	github.com/golang/protobuf v1.5.2
-	github.com/klauspost/compress v1.15.1 // indirect
+	github.com/klauspost/compress v1.15.1
 	github.com/nats-io/nats-server/v2 v2.7.4
 	github.com/nats-io/nkeys v0.3.0
 	github.com/nats-io/nuid v1.0.1
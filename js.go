@@ -245,6 +245,9 @@ type jsOpts struct {
 	directGet bool
 	// For direct get next message
 	directNextFor string
+	// For direct get responses from the mirrors of the stream, the prefix
+	// of the subjects of the messages they may return.
+	directMirrorSubjPre string
 }
 
 const (
@@ -361,6 +364,16 @@ func DirectGetNext(subject string) JSOpt {
 	})
 }
 
+// directGetFromMirrors accepts the direct get responses of the mirrors, created
+// with MirrorDirect, of the requested stream, when the subject of the message
+// has the given prefix.
+func directGetFromMirrors(subjPre string) JSOpt {
+	return jsOptFn(func(js *jsOpts) error {
+		js.directMirrorSubjPre = subjPre
+		return nil
+	})
+}
+
 // StreamListFilter is an option that can be used to configure `StreamsInfo()` and `StreamNames()` requests.
 // It allows filtering the retured streams by subject associated with each stream.
 // Wildcards can be used. For example, `StreamListFilter(FOO.*.A) will return
@@ -505,14 +518,16 @@ func (js *js) PublishMsg(m *Msg, opts ...PubOpt) (*PubAck, error) {
 	if err != nil {
 		for r, ttl := 0, o.ttl; err == ErrNoResponders && (r < o.rnum || o.rnum < 0); r++ {
 			// To protect against small blips in leadership changes etc, if we get a no responders here retry.
+			t := js.nc.getTimer(o.rwait)
 			if o.ctx != nil {
 				select {
 				case <-o.ctx.Done():
-				case <-time.After(o.rwait):
+				case <-t.C():
 				}
 			} else {
-				time.Sleep(o.rwait)
+				<-t.C()
 			}
+			js.nc.putTimer(t)
 			if o.ttl > 0 {
 				ttl -= o.rwait
 				if ttl <= 0 {
@@ -840,13 +855,15 @@ func (js *js) PublishMsgAsync(m *Msg, opts ...PubOpt) (PubAckFuture, error) {
 	}
 
 	id := m.Reply[aReplyPreLen:]
-	paf := &pubAckFuture{msg: m, st: time.Now()}
+	paf := &pubAckFuture{msg: m, st: js.nc.Opts.clock().Now()}
 	numPending, maxPending := js.registerPAF(id, paf)
 
 	if maxPending > 0 && numPending >= maxPending {
+		t := js.nc.getTimer(stallWait)
+		defer js.nc.putTimer(t)
 		select {
 		case <-js.asyncStall():
-		case <-time.After(stallWait):
+		case <-t.C():
 			js.clearPAF(id)
 			return nil, errors.New("nats: stalled with too many outstanding async published messages")
 		}
@@ -1134,14 +1151,14 @@ type jsSub struct {
 	ccreq   *createConsumerRequest
 
 	// Heartbeats and Flow Control handling from push consumers.
-	hbc    *time.Timer
+	hbc    Timer
 	hbi    time.Duration
 	active bool
 	cmeta  string
 	fcr    string
 	fcd    uint64
 	fciseq uint64
-	csfct  *time.Timer
+	csfct  Timer
 
 	// Cancellation function to cancel context on drain/unsubscribe.
 	cancel func()
@@ -1778,7 +1795,7 @@ func (sub *Subscription) chanSubcheckForFlowControlResponse() {
 
 	jsi := sub.jsi
 	if jsi.csfct == nil {
-		jsi.csfct = time.AfterFunc(chanSubFCCheckInterval, sub.chanSubcheckForFlowControlResponse)
+		jsi.csfct = sub.conn.Opts.clock().AfterFunc(chanSubFCCheckInterval, sub.chanSubcheckForFlowControlResponse)
 	} else {
 		fcReply = sub.checkForFlowControlResponse()
 		nc = sub.conn
@@ -1917,6 +1934,12 @@ func (sub *Subscription) resetOrderedConsumer(sseq uint64) {
 		}
 	}
 
+	nc.log(LogInfo, "ordered consumer reset",
+		LogField{LogFieldStream, sub.jsi.stream},
+		LogField{LogFieldSubject, sub.jsi.psubj},
+		LogField{LogFieldSid, sub.sid},
+		LogField{LogFieldSequence, sseq})
+
 	// Quick unsubscribe. Since we know this is a simple push subscriber we do in place.
 	osid := sub.applyNewSID()
 
@@ -2043,13 +2066,17 @@ func (sub *Subscription) activityCheck() {
 	jsi.hbc.Reset(jsi.hbi * hbcThresh)
 	jsi.active = false
 	nc := sub.conn
+	stream, consumer, subject, sid := jsi.stream, jsi.consumer, sub.Subject, sub.sid
 	sub.mu.Unlock()
 
 	if !active {
 		nc.mu.Lock()
-		if errCB := nc.Opts.AsyncErrorCB; errCB != nil {
-			nc.ach.push(func() { errCB(nc, sub, ErrConsumerNotActive) })
-		}
+		nc.log(LogWarn, "consumer heartbeat missed",
+			LogField{LogFieldStream, stream},
+			LogField{LogFieldConsumer, consumer},
+			LogField{LogFieldSubject, subject},
+			LogField{LogFieldSid, sid})
+		nc.pushAsyncErr(sub, ErrConsumerNotActive)
 		nc.mu.Unlock()
 	}
 }
@@ -2066,7 +2093,7 @@ func (sub *Subscription) scheduleHeartbeatCheck() {
 	}
 
 	if jsi.hbc == nil {
-		jsi.hbc = time.AfterFunc(jsi.hbi*hbcThresh, sub.activityCheck)
+		jsi.hbc = sub.conn.Opts.clock().AfterFunc(jsi.hbi*hbcThresh, sub.activityCheck)
 	} else {
 		jsi.hbc.Reset(jsi.hbi * hbcThresh)
 	}
@@ -2075,10 +2102,7 @@ func (sub *Subscription) scheduleHeartbeatCheck() {
 // handleConsumerSequenceMismatch will send an async error that can be used to restart a push based consumer.
 func (nc *Conn) handleConsumerSequenceMismatch(sub *Subscription, err error) {
 	nc.mu.Lock()
-	errCB := nc.Opts.AsyncErrorCB
-	if errCB != nil {
-		nc.ach.push(func() { errCB(nc, sub, err) })
-	}
+	nc.pushAsyncErr(sub, err)
 	nc.mu.Unlock()
 }
 
@@ -145,6 +145,16 @@ type StreamSource struct {
 	OptStartTime  *time.Time      `json:"opt_start_time,omitempty"`
 	FilterSubject string          `json:"filter_subject,omitempty"`
 	External      *ExternalStream `json:"external,omitempty"`
+
+	// Remap the subjects of the sourced messages. Requires server support.
+	SubjectTransforms []SubjectTransformConfig `json:"subject_transforms,omitempty"`
+}
+
+// SubjectTransformConfig is for applying a subject transform (to matching
+// messages) when a message is sourced from another stream.
+type SubjectTransformConfig struct {
+	Source      string `json:"src"`
+	Destination string `json:"dest"`
 }
 
 // ExternalStream allows you to qualify access to a stream source in another
@@ -154,6 +164,24 @@ type ExternalStream struct {
 	DeliverPrefix string `json:"deliver"`
 }
 
+// Helper for copying when we do not want to change user's version.
+func (ss *StreamSource) copy() *StreamSource {
+	nss := *ss
+	// Check pointers
+	if ss.OptStartTime != nil {
+		t := *ss.OptStartTime
+		nss.OptStartTime = &t
+	}
+	if ss.External != nil {
+		ext := *ss.External
+		nss.External = &ext
+	}
+	if ss.SubjectTransforms != nil {
+		nss.SubjectTransforms = append([]SubjectTransformConfig(nil), ss.SubjectTransforms...)
+	}
+	return &nss
+}
+
 // apiResponse is a standard response from the JetStream JSON API
 type apiResponse struct {
 	Type  string    `json:"type"`
@@ -687,7 +715,17 @@ type (
 		// SubjectsFilter when set, returns information on the matched subjects
 		SubjectsFilter string `json:"subjects_filter,omitempty"`
 	}
-	streamInfoResponse = streamCreateResponse
+	// streamInfoPagedRequest is the StreamInfoRequest sent for each page
+	// of subjects.
+	streamInfoPagedRequest struct {
+		apiPagedRequest
+		*StreamInfoRequest
+	}
+	streamInfoResponse = struct {
+		apiResponse
+		apiPaged
+		*StreamInfo
+	}
 )
 
 func (js *js) StreamInfo(stream string, opts ...JSOpt) (*StreamInfo, error) {
@@ -701,30 +739,51 @@ func (js *js) StreamInfo(stream string, opts ...JSOpt) (*StreamInfo, error) {
 	if cancel != nil {
 		defer cancel()
 	}
-	var req []byte
-	if o.streamInfoOpts != nil {
-		if req, err = json.Marshal(o.streamInfoOpts); err != nil {
-			return nil, err
-		}
-	}
 	siSubj := js.apiSubj(fmt.Sprintf(apiStreamInfoT, stream))
 
-	r, err := js.apiRequestWithContext(o.ctx, siSubj, req)
-	if err != nil {
-		return nil, err
-	}
-	var resp streamInfoResponse
-	if err := json.Unmarshal(r.Data, &resp); err != nil {
-		return nil, err
-	}
-	if resp.Error != nil {
-		if errors.Is(resp.Error, ErrStreamNotFound) {
-			return nil, ErrStreamNotFound
+	// The subjects details are paged, gather all of them.
+	var subjects map[string]uint64
+	for {
+		var req []byte
+		if o.streamInfoOpts != nil {
+			siOpts := streamInfoPagedRequest{apiPagedRequest{Offset: len(subjects)}, o.streamInfoOpts}
+			if req, err = json.Marshal(&siOpts); err != nil {
+				return nil, err
+			}
+		}
+		r, err := js.apiRequestWithContext(o.ctx, siSubj, req)
+		if err != nil {
+			return nil, err
+		}
+		var resp streamInfoResponse
+		if err := json.Unmarshal(r.Data, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Error != nil {
+			if errors.Is(resp.Error, ErrStreamNotFound) {
+				return nil, ErrStreamNotFound
+			}
+			return nil, resp.Error
+		}
+		if subjects == nil && len(resp.State.Subjects) >= resp.Total {
+			return resp.StreamInfo, nil
+		}
+		if len(resp.State.Subjects) == 0 {
+			// Nothing more was returned, do not loop forever.
+			resp.State.Subjects = subjects
+			return resp.StreamInfo, nil
+		}
+		if subjects == nil {
+			subjects = make(map[string]uint64, resp.Total)
+		}
+		for subj, n := range resp.State.Subjects {
+			subjects[subj] = n
+		}
+		if len(subjects) >= resp.Total {
+			resp.State.Subjects = subjects
+			return resp.StreamInfo, nil
 		}
-		return nil, resp.Error
 	}
-
-	return resp.StreamInfo, nil
 }
 
 // StreamInfo shows config and current state for this stream.
@@ -922,7 +981,7 @@ func (js *js) getMsg(name string, mreq *apiMsgGetRequest, opts ...JSOpt) (*RawSt
 			return nil, err
 		}
 
-		return convertDirectGetMsgResponseToMsg(name, r)
+		return convertDirectGetMsgResponse(name, o.directMirrorSubjPre, r)
 	}
 
 	if o.directGet {
@@ -944,7 +1003,7 @@ func (js *js) getMsg(name string, mreq *apiMsgGetRequest, opts ...JSOpt) (*RawSt
 	}
 
 	if o.directGet {
-		return convertDirectGetMsgResponseToMsg(name, r)
+		return convertDirectGetMsgResponse(name, o.directMirrorSubjPre, r)
 	}
 
 	var resp apiMsgGetResponse
@@ -981,6 +1040,13 @@ func (js *js) getMsg(name string, mreq *apiMsgGetRequest, opts ...JSOpt) (*RawSt
 }
 
 func convertDirectGetMsgResponseToMsg(name string, r *Msg) (*RawStreamMsg, error) {
+	return convertDirectGetMsgResponse(name, _EMPTY_, r)
+}
+
+// convertDirectGetMsgResponse converts the response, which may come from a
+// mirror of the stream if mirrorSubjPre is set and the subject of the message
+// has that prefix.
+func convertDirectGetMsgResponse(name, mirrorSubjPre string, r *Msg) (*RawStreamMsg, error) {
 	// Check for 404/408. We would get a no-payload message and a "Status" header
 	if len(r.Data) == 0 {
 		val := r.Header.Get(statusHdr)
@@ -1006,7 +1072,7 @@ func convertDirectGetMsgResponseToMsg(name string, r *Msg) (*RawStreamMsg, error
 	if stream == _EMPTY_ {
 		return nil, fmt.Errorf("nats: missing stream header")
 	}
-	if stream != name {
+	if stream != name && (mirrorSubjPre == _EMPTY_ || !strings.HasPrefix(r.Header.Get(JSSubject), mirrorSubjPre)) {
 		return nil, fmt.Errorf("nats: response stream header is '%s', not '%s'", stream, name)
 	}
 	seqStr := r.Header.Get(JSSequence)
@@ -17,6 +17,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 	"reflect"
 	"regexp"
 	"strconv"
@@ -35,6 +36,10 @@ type KeyValueManager interface {
 	CreateKeyValue(cfg *KeyValueConfig) (KeyValue, error)
 	// DeleteKeyValue will delete this KeyValue store (JetStream stream).
 	DeleteKeyValue(bucket string) error
+	// KeyValueStoreNames is used to retrieve a list of key value store names.
+	KeyValueStoreNames(opts ...JSOpt) <-chan string
+	// KeyValueStores is used to retrieve the status of all key value stores.
+	KeyValueStores(opts ...JSOpt) <-chan KeyValueStatus
 }
 
 // Notice: Experimental Preview
@@ -90,6 +95,24 @@ type KeyValueStatus interface {
 
 	// BackingStore indicates what technology is used for storage of the bucket
 	BackingStore() string
+
+	// Bytes is the size of the bucket in bytes, including historical values
+	Bytes() uint64
+
+	// Replicas indicates how many storage replicas are kept for the data in the bucket
+	Replicas() int
+
+	// Storage indicates the underlying JetStream storage technology used to store data
+	Storage() StorageType
+
+	// Mirror returns information about the bucket this bucket mirrors, if any
+	Mirror() *StreamSourceInfo
+
+	// Sources returns information about the buckets this bucket sources from, if any
+	Sources() []*StreamSourceInfo
+
+	// LastRevision is the revision of the last update made to the bucket
+	LastRevision() uint64
 }
 
 // KeyWatcher is what is returned when doing a watch.
@@ -120,6 +143,12 @@ type watchOpts struct {
 	includeHistory bool
 	// retrieve only the meta data of the entry
 	metaOnly bool
+	// Resume from this revision (inclusive) instead of the latest values.
+	resumeFromRevision uint64
+	// Load and persist the last revision seen by the watcher.
+	revStore RevisionStore
+	// Names of the objects reported by an object watcher.
+	namePatterns []string
 }
 
 type watchOptFn func(opts *watchOpts) error
@@ -152,6 +181,122 @@ func MetaOnly() WatchOpt {
 	})
 }
 
+// ResumeFromRevision instructs the key watcher to deliver all updates starting
+// at the given revision, instead of the latest values. Updates replaced since,
+// for instance because of the history limit of the keys, are skipped, but the
+// latest value of each key is delivered. If the bucket no longer holds updates
+// from that revision, for instance after a purge of the bucket or because of
+// its TTL, Watch will return ErrRevisionCompacted.
+func ResumeFromRevision(revision uint64) WatchOpt {
+	return watchOptFn(func(opts *watchOpts) error {
+		if revision == 0 {
+			return errors.New("nats: revision must be greater than 0")
+		}
+		opts.resumeFromRevision = revision
+		return nil
+	})
+}
+
+// PersistRevision instructs the key watcher to resume right after the last
+// revision recorded in the given store, unless ResumeFromRevision() is also
+// specified. The application records the revision of an entry once it has
+// processed it, with its CommitRevision() method:
+//
+//	for e := range w.Updates() {
+//		if e == nil {
+//			continue
+//		}
+//		// process e...
+//		if err := e.(nats.RevisionCommitter).CommitRevision(); err != nil {
+//			// handle the error
+//		}
+//	}
+//
+// Entries should be committed in the order they are received. The store can
+// not be a key of the watched bucket.
+func PersistRevision(store RevisionStore) WatchOpt {
+	return watchOptFn(func(opts *watchOpts) error {
+		if store == nil {
+			return errors.New("nats: revision store required")
+		}
+		opts.revStore = store
+		return nil
+	})
+}
+
+// RevisionCommitter is implemented by the entries of the watchers created with
+// PersistRevision(), and by the events of object store watchers.
+type RevisionCommitter interface {
+	// CommitRevision records the revision of the entry in the store of the
+	// watcher.
+	CommitRevision() error
+}
+
+// RevisionStore is used by key watchers to persist the last revision seen,
+// so that a restarted watcher only receives updates after that point.
+type RevisionStore interface {
+	// LoadRevision returns the last stored revision, or 0 if none.
+	LoadRevision() (uint64, error)
+	// StoreRevision records the last revision processed by the watcher.
+	StoreRevision(revision uint64) error
+}
+
+// FileRevisionStore returns a RevisionStore that keeps the revision in the
+// given file. The file is replaced atomically on each update.
+func FileRevisionStore(path string) RevisionStore {
+	return &fileRevStore{path: path}
+}
+
+type fileRevStore struct {
+	path string
+}
+
+func (fs *fileRevStore) LoadRevision() (uint64, error) {
+	b, err := os.ReadFile(fs.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+func (fs *fileRevStore) StoreRevision(revision uint64) error {
+	tmp := fs.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(revision, 10)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fs.path)
+}
+
+// KeyValueRevisionStore returns a RevisionStore that keeps the revision
+// under the given key of a KeyValue store.
+func KeyValueRevisionStore(kv KeyValue, key string) RevisionStore {
+	return &kvRevStore{kv: kv, key: key}
+}
+
+type kvRevStore struct {
+	kv  KeyValue
+	key string
+}
+
+func (ks *kvRevStore) LoadRevision() (uint64, error) {
+	e, err := ks.kv.Get(ks.key)
+	if err != nil {
+		if err == ErrKeyNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseUint(string(e.Value()), 10, 64)
+}
+
+func (ks *kvRevStore) StoreRevision(revision uint64) error {
+	_, err := ks.kv.PutString(ks.key, strconv.FormatUint(revision, 10))
+	return err
+}
+
 type PurgeOpt interface {
 	configurePurge(opts *purgeOpts) error
 }
@@ -226,6 +371,12 @@ type KeyValueConfig struct {
 	Replicas     int
 	Placement    *Placement
 	RePublish    *RePublish
+	// Mirror makes this bucket a read-only mirror of another bucket.
+	Mirror *StreamSource
+	// Sources will have this bucket aggregate the keys of other buckets.
+	// The keys are remapped with subject transforms, which require server
+	// version 2.10.0 or above.
+	Sources []*StreamSource
 }
 
 // Used to watch all keys.
@@ -279,22 +430,28 @@ type KeyValueEntry interface {
 
 // Errors
 var (
-	ErrKeyValueConfigRequired = errors.New("nats: config required")
-	ErrInvalidBucketName      = errors.New("nats: invalid bucket name")
-	ErrInvalidKey             = errors.New("nats: invalid key")
-	ErrBucketNotFound         = errors.New("nats: bucket not found")
-	ErrBadBucket              = errors.New("nats: bucket not valid key-value store")
-	ErrKeyNotFound            = errors.New("nats: key not found")
-	ErrKeyDeleted             = errors.New("nats: key was deleted")
-	ErrHistoryToLarge         = errors.New("nats: history limited to a max of 64")
-	ErrNoKeysFound            = errors.New("nats: no keys found")
+	ErrKeyValueConfigRequired      = errors.New("nats: config required")
+	ErrInvalidBucketName           = errors.New("nats: invalid bucket name")
+	ErrInvalidKey                  = errors.New("nats: invalid key")
+	ErrBucketNotFound              = errors.New("nats: bucket not found")
+	ErrBadBucket                   = errors.New("nats: bucket not valid key-value store")
+	ErrKeyNotFound                 = errors.New("nats: key not found")
+	ErrKeyDeleted                  = errors.New("nats: key was deleted")
+	ErrHistoryToLarge              = errors.New("nats: history limited to a max of 64")
+	ErrNoKeysFound                 = errors.New("nats: no keys found")
+	ErrRevisionCompacted           = errors.New("nats: revision is no longer available in the bucket")
+	ErrNoRevisionStore             = errors.New("nats: watcher does not persist revisions")
+	ErrRevisionStoreInBucket       = errors.New("nats: revision store can not be in the watched bucket")
+	ErrKeyValueSourcesNotSupported = errors.New("nats: key-value sources require at least server version 2.10.0")
 )
 
 const (
-	kvBucketNameTmpl  = "KV_%s"
-	kvSubjectsTmpl    = "$KV.%s.>"
-	kvSubjectsPreTmpl = "$KV.%s."
-	kvNoPending       = "0"
+	kvBucketNamePre         = "KV_"
+	kvBucketNameTmpl        = "KV_%s"
+	kvSubjectsTmpl          = "$KV.%s.>"
+	kvSubjectsPreTmpl       = "$KV.%s."
+	kvSubjectsPreDomainTmpl = "%s.$KV.%s."
+	kvNoPending             = "0"
 )
 
 // Regex for valid keys and buckets.
@@ -325,16 +482,7 @@ func (js *js) KeyValue(bucket string) (KeyValue, error) {
 		return nil, ErrBadBucket
 	}
 
-	kv := &kvs{
-		name:   bucket,
-		stream: stream,
-		pre:    fmt.Sprintf(kvSubjectsPreTmpl, bucket),
-		js:     js,
-		// Determine if we need to use the JS prefix in front of Put and Delete operations
-		useJSPfx:  js.opts.pre != defaultAPIPrefix,
-		useDirect: si.Config.AllowDirect,
-	}
-	return kv, nil
+	return mapStreamToKVS(js, bucket, si), nil
 }
 
 // CreateKeyValue will create a KeyValue store with the following configuration.
@@ -388,7 +536,6 @@ func (js *js) CreateKeyValue(cfg *KeyValueConfig) (KeyValue, error) {
 	scfg := &StreamConfig{
 		Name:              fmt.Sprintf(kvBucketNameTmpl, cfg.Bucket),
 		Description:       cfg.Description,
-		Subjects:          []string{fmt.Sprintf(kvSubjectsTmpl, cfg.Bucket)},
 		MaxMsgsPerSubject: history,
 		MaxBytes:          maxBytes,
 		MaxAge:            cfg.TTL,
@@ -405,6 +552,41 @@ func (js *js) CreateKeyValue(cfg *KeyValueConfig) (KeyValue, error) {
 		RePublish:         cfg.RePublish,
 	}
 
+	// A mirror can not have subjects and will keep the subjects of the
+	// origin bucket. Sources are remapped into our own subject namespace.
+	if cfg.Mirror != nil {
+		// Copy so we do not change caller's version.
+		m := cfg.Mirror.copy()
+		if !strings.HasPrefix(m.Name, kvBucketNamePre) {
+			m.Name = fmt.Sprintf(kvBucketNameTmpl, m.Name)
+		}
+		scfg.Mirror = m
+		scfg.MirrorDirect = true
+		// Mirrors can not have a de-duplication window.
+		scfg.Duplicates = 0
+	} else {
+		for _, ss := range cfg.Sources {
+			ss = ss.copy()
+			sbucket := strings.TrimPrefix(ss.Name, kvBucketNamePre)
+			ss.Name = fmt.Sprintf(kvBucketNameTmpl, sbucket)
+			// A bucket with the same name in another domain already
+			// uses the same subjects.
+			if ss.External == nil || sbucket != cfg.Bucket {
+				// Older servers ignore the transforms, which would leave
+				// the keys of the source unreadable in this bucket.
+				if !js.nc.serverMinVersion(2, 10, 0) {
+					return nil, ErrKeyValueSourcesNotSupported
+				}
+				ss.SubjectTransforms = []SubjectTransformConfig{{
+					Source:      fmt.Sprintf(kvSubjectsTmpl, sbucket),
+					Destination: fmt.Sprintf(kvSubjectsTmpl, cfg.Bucket),
+				}}
+			}
+			scfg.Sources = append(scfg.Sources, ss)
+		}
+		scfg.Subjects = []string{fmt.Sprintf(kvSubjectsTmpl, cfg.Bucket)}
+	}
+
 	// If we are at server version 2.7.2 or above use DiscardNew. We can not use DiscardNew for 2.7.1 or below.
 	if js.nc.serverMinVersion(2, 7, 2) {
 		scfg.Discard = DiscardNew
@@ -432,16 +614,36 @@ func (js *js) CreateKeyValue(cfg *KeyValueConfig) (KeyValue, error) {
 		}
 	}
 
+	return mapStreamToKVS(js, cfg.Bucket, si), nil
+}
+
+func mapStreamToKVS(js *js, bucket string, si *StreamInfo) *kvs {
 	kv := &kvs{
-		name:   cfg.Bucket,
-		stream: scfg.Name,
-		pre:    fmt.Sprintf(kvSubjectsPreTmpl, cfg.Bucket),
+		name:   bucket,
+		stream: si.Config.Name,
+		pre:    fmt.Sprintf(kvSubjectsPreTmpl, bucket),
 		js:     js,
 		// Determine if we need to use the JS prefix in front of Put and Delete operations
 		useJSPfx:  js.opts.pre != defaultAPIPrefix,
 		useDirect: si.Config.AllowDirect,
 	}
-	return kv, nil
+	if si.Config.MaxMsgSize > 0 {
+		kv.maxValue = int64(si.Config.MaxMsgSize)
+	}
+
+	// A mirror holds the keys under the subjects of the origin bucket,
+	// and writes need to go to the origin bucket.
+	if m := si.Config.Mirror; m != nil {
+		origin := strings.TrimPrefix(m.Name, kvBucketNamePre)
+		kv.pre = fmt.Sprintf(kvSubjectsPreTmpl, origin)
+		if m.External != nil && m.External.APIPrefix != _EMPTY_ {
+			kv.useJSPfx = false
+			kv.putPre = fmt.Sprintf(kvSubjectsPreDomainTmpl, m.External.APIPrefix, origin)
+		} else {
+			kv.putPre = kv.pre
+		}
+	}
+	return kv
 }
 
 // DeleteKeyValue will delete this KeyValue store (JetStream stream).
@@ -453,17 +655,90 @@ func (js *js) DeleteKeyValue(bucket string) error {
 	return js.DeleteStream(stream)
 }
 
+// KeyValueStoreNames is used to retrieve a list of key value store names.
+func (jsc *js) KeyValueStoreNames(opts ...JSOpt) <-chan string {
+	o, cancel, err := getJSContextOpts(jsc.opts, opts...)
+	if err != nil {
+		return nil
+	}
+
+	ch := make(chan string)
+	l := &streamNamesLister{js: &js{nc: jsc.nc, opts: o}}
+	go func() {
+		if cancel != nil {
+			defer cancel()
+		}
+		defer close(ch)
+		for l.Next() {
+			for _, name := range l.Page() {
+				if !strings.HasPrefix(name, kvBucketNamePre) {
+					continue
+				}
+				select {
+				case ch <- strings.TrimPrefix(name, kvBucketNamePre):
+				case <-o.ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+// KeyValueStores is used to retrieve the status of all key value stores.
+func (jsc *js) KeyValueStores(opts ...JSOpt) <-chan KeyValueStatus {
+	o, cancel, err := getJSContextOpts(jsc.opts, opts...)
+	if err != nil {
+		return nil
+	}
+
+	ch := make(chan KeyValueStatus)
+	l := &streamLister{js: &js{nc: jsc.nc, opts: o}}
+	go func() {
+		if cancel != nil {
+			defer cancel()
+		}
+		defer close(ch)
+		for l.Next() {
+			for _, info := range l.Page() {
+				if !strings.HasPrefix(info.Config.Name, kvBucketNamePre) {
+					continue
+				}
+				status := &KeyValueBucketStatus{
+					nfo:    info,
+					bucket: strings.TrimPrefix(info.Config.Name, kvBucketNamePre),
+				}
+				select {
+				case ch <- status:
+				case <-o.ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
 type kvs struct {
 	name   string
 	stream string
 	pre    string
 	js     *js
+	// If set, the prefix to use for Put and Delete operations,
+	// for instance when the bucket is a mirror.
+	putPre string
 	// If true, it means that APIPrefix/Domain was set in the context
 	// and we need to add something to some of our high level protocols
 	// (such as Put, etc..)
 	useJSPfx bool
 	// To know if we can use the stream direct get API
 	useDirect bool
+	// Transforms applied to the values, see KeyValueWithTransforms().
+	transforms []ValueTransformer
+	// The MaxValueSize of the bucket, if any.
+	maxValue int64
 }
 
 // Underlying entry.
@@ -475,6 +750,8 @@ type kve struct {
 	delta    uint64
 	created  time.Time
 	op       KeyValueOp
+	// Store of the watcher that delivered the entry, if any.
+	revStore RevisionStore
 }
 
 func (e *kve) Bucket() string        { return e.bucket }
@@ -485,6 +762,15 @@ func (e *kve) Created() time.Time    { return e.created }
 func (e *kve) Delta() uint64         { return e.delta }
 func (e *kve) Operation() KeyValueOp { return e.op }
 
+// CommitRevision records the revision of the entry in the store of the
+// watcher that delivered it.
+func (e *kve) CommitRevision() error {
+	if e.revStore == nil {
+		return ErrNoRevisionStore
+	}
+	return e.revStore.StoreRevision(e.revision)
+}
+
 func keyValid(key string) bool {
 	if len(key) == 0 || key[0] == '.' || key[len(key)-1] == '.' {
 		return false
@@ -529,11 +815,13 @@ func (kv *kvs) get(key string, revision uint64) (KeyValueEntry, error) {
 
 	var m *RawStreamMsg
 	var err error
-	var _opts [1]JSOpt
+	var _opts [2]JSOpt
 	opts := _opts[:0]
 	if kv.useDirect {
-		_opts[0] = DirectGet()
-		opts = _opts[:1]
+		// The mirrors of the bucket can answer for it, with the subjects
+		// of the keys of the bucket.
+		_opts[0], _opts[1] = DirectGet(), directGetFromMirrors(kv.pre)
+		opts = _opts[:2]
 	}
 	if revision == kvLatestRevision {
 		m, err = kv.js.GetLastMsg(kv.stream, b.String(), opts...)
@@ -570,6 +858,9 @@ func (kv *kvs) get(key string, revision uint64) (KeyValueEntry, error) {
 			entry.op = KeyValuePurge
 			return entry, ErrKeyDeleted
 		}
+		if entry.value, err = decodeValue(kv.transforms, key, kv.maxValueSize(), m.Header, m.Data); err != nil {
+			return nil, err
+		}
 	}
 
 	return entry, nil
@@ -585,16 +876,47 @@ func (kv *kvs) Put(key string, value []byte) (revision uint64, err error) {
 	if kv.useJSPfx {
 		b.WriteString(kv.js.opts.pre)
 	}
-	b.WriteString(kv.pre)
+	if kv.putPre != _EMPTY_ {
+		b.WriteString(kv.putPre)
+	} else {
+		b.WriteString(kv.pre)
+	}
 	b.WriteString(key)
 
-	pa, err := kv.js.Publish(b.String(), value)
+	m := &Msg{Subject: b.String(), Data: value}
+	if err := kv.encodeValue(key, m); err != nil {
+		return 0, err
+	}
+	pa, err := kv.js.PublishMsg(m)
 	if err != nil {
 		return 0, err
 	}
 	return pa.Sequence, err
 }
 
+// maxValueSize returns the maximum size of the values before they are
+// transformed, which is the bucket's MaxValueSize or the server's maximum
+// payload.
+func (kv *kvs) maxValueSize() int64 {
+	if kv.maxValue > 0 {
+		return kv.maxValue
+	}
+	return kv.js.nc.MaxPayload()
+}
+
+// encodeValue applies the transforms of the bucket to the value of m.
+func (kv *kvs) encodeValue(key string, m *Msg) error {
+	if len(kv.transforms) == 0 {
+		return nil
+	}
+	// Values that can not be decoded later on are rejected, even if
+	// they would fit once transformed.
+	if int64(len(m.Data)) > kv.maxValueSize() {
+		return ErrValueTooLarge
+	}
+	return encodeValue(kv.transforms, key, m)
+}
+
 // PutString will place the string for the key into the store.
 func (kv *kvs) PutString(key string, value string) (revision uint64, err error) {
 	return kv.Put(key, []byte(value))
@@ -626,11 +948,18 @@ func (kv *kvs) Update(key string, value []byte, revision uint64) (uint64, error)
 	if kv.useJSPfx {
 		b.WriteString(kv.js.opts.pre)
 	}
-	b.WriteString(kv.pre)
+	if kv.putPre != _EMPTY_ {
+		b.WriteString(kv.putPre)
+	} else {
+		b.WriteString(kv.pre)
+	}
 	b.WriteString(key)
 
 	m := Msg{Subject: b.String(), Header: Header{}, Data: value}
 	m.Header.Set(ExpectedLastSubjSeqHdr, strconv.FormatUint(revision, 10))
+	if err := kv.encodeValue(key, &m); err != nil {
+		return 0, err
+	}
 
 	pa, err := kv.js.PublishMsg(&m)
 	if err != nil {
@@ -649,7 +978,11 @@ func (kv *kvs) Delete(key string, opts ...DeleteOpt) error {
 	if kv.useJSPfx {
 		b.WriteString(kv.js.opts.pre)
 	}
-	b.WriteString(kv.pre)
+	if kv.putPre != _EMPTY_ {
+		b.WriteString(kv.putPre)
+	} else {
+		b.WriteString(kv.pre)
+	}
 	b.WriteString(key)
 
 	// DEL op marker. For watch functionality.
@@ -848,12 +1181,28 @@ func (kv *kvs) Watch(keys string, opts ...WatchOpt) (KeyWatcher, error) {
 		}
 	}
 
+	if len(o.namePatterns) > 0 {
+		return nil, errors.New("nats: name patterns are only supported by object watchers")
+	}
+
 	// Could be a pattern so don't check for validity as we normally do.
 	var b strings.Builder
 	b.WriteString(kv.pre)
 	b.WriteString(keys)
 	keys = b.String()
 
+	// Storing the revisions in the watched bucket would feed back into the
+	// watcher, and be seen as compaction on resume.
+	if ks, ok := o.revStore.(*kvRevStore); ok && ks.kv.Bucket() == kv.name {
+		return nil, ErrRevisionStoreInBucket
+	}
+
+	// Figure out if we need to resume from a given revision.
+	start, err := resumeRevision(kv.js, kv.stream, &o)
+	if err != nil {
+		return nil, err
+	}
+
 	// We will block below on placing items on the chan. That is by design.
 	w := &watcher{updates: make(chan KeyValueEntry, 256), ctx: o.ctx}
 
@@ -877,6 +1226,7 @@ func (kv *kvs) Watch(keys string, opts ...WatchOpt) (KeyWatcher, error) {
 			}
 		}
 		delta := uint64(parseNum(tokens[ackNumPendingTokenPos]))
+		revision := uint64(parseNum(tokens[ackStreamSeqTokenPos]))
 		w.mu.Lock()
 		defer w.mu.Unlock()
 		if !o.ignoreDeletes || (op != KeyValueDelete && op != KeyValuePurge) {
@@ -884,12 +1234,20 @@ func (kv *kvs) Watch(keys string, opts ...WatchOpt) (KeyWatcher, error) {
 				bucket:   kv.name,
 				key:      subj,
 				value:    m.Data,
-				revision: uint64(parseNum(tokens[ackStreamSeqTokenPos])),
+				revision: revision,
 				created:  time.Unix(0, parseNum(tokens[ackTimestampSeqTokenPos])),
 				delta:    delta,
 				op:       op,
+				revStore: o.revStore,
+			}
+			if op == KeyValuePut && !o.metaOnly {
+				entry.value, err = decodeValue(kv.transforms, subj, kv.maxValueSize(), m.Header, m.Data)
+			}
+			if err != nil {
+				kv.asyncErr(m.Sub, err)
+			} else {
+				w.updates <- entry
 			}
-			w.updates <- entry
 		}
 		// Check if done and initial values.
 		if !w.initDone {
@@ -906,8 +1264,10 @@ func (kv *kvs) Watch(keys string, opts ...WatchOpt) (KeyWatcher, error) {
 	}
 
 	// Used ordered consumer to deliver results.
-	subOpts := []SubOpt{OrderedConsumer()}
-	if !o.includeHistory {
+	subOpts := []SubOpt{BindStream(kv.stream), OrderedConsumer()}
+	if start > 0 {
+		subOpts = append(subOpts, StartSequence(start))
+	} else if !o.includeHistory {
 		subOpts = append(subOpts, DeliverLastPerSubject())
 	}
 	if o.metaOnly {
@@ -942,6 +1302,45 @@ func (kv *kvs) Watch(keys string, opts ...WatchOpt) (KeyWatcher, error) {
 	return w, nil
 }
 
+// resumeRevision returns the revision a watcher resumes from, 0 if it does not,
+// or ErrRevisionCompacted if messages of the stream at or after it have been
+// removed from the start of the stream, for instance by the age limit or a
+// purge of the stream. Messages removed inside the stream, by the history
+// limit or a purge of a key, are superseded by later messages of the same
+// keys, so the watcher still delivers the latest values.
+func resumeRevision(js *js, stream string, o *watchOpts) (uint64, error) {
+	start := o.resumeFromRevision
+	if start == 0 && o.revStore != nil {
+		last, err := o.revStore.LoadRevision()
+		if err != nil {
+			return 0, err
+		}
+		if last > 0 {
+			start = last + 1
+		}
+	}
+	if start == 0 {
+		return 0, nil
+	}
+	si, err := js.StreamInfo(stream)
+	if err != nil {
+		return 0, err
+	}
+	if start < si.State.FirstSeq {
+		return 0, ErrRevisionCompacted
+	}
+	return start, nil
+}
+
+// asyncErr reports an error that occurred in a watcher callback
+// to the connection's asynchronous error handler, if any.
+func (kv *kvs) asyncErr(sub *Subscription, err error) {
+	nc := kv.js.nc
+	nc.mu.Lock()
+	nc.pushAsyncErr(sub, err)
+	nc.mu.Unlock()
+}
+
 // Bucket returns the current bucket name (JetStream stream).
 func (kv *kvs) Bucket() string {
 	return kv.name
@@ -968,6 +1367,24 @@ func (s *KeyValueBucketStatus) TTL() time.Duration { return s.nfo.Config.MaxAge
 // BackingStore indicates what technology is used for storage of the bucket
 func (s *KeyValueBucketStatus) BackingStore() string { return "JetStream" }
 
+// Bytes is the size of the bucket in bytes, including historical values
+func (s *KeyValueBucketStatus) Bytes() uint64 { return s.nfo.State.Bytes }
+
+// Replicas indicates how many storage replicas are kept for the data in the bucket
+func (s *KeyValueBucketStatus) Replicas() int { return s.nfo.Config.Replicas }
+
+// Storage indicates the underlying JetStream storage technology used to store data
+func (s *KeyValueBucketStatus) Storage() StorageType { return s.nfo.Config.Storage }
+
+// Mirror returns information about the bucket this bucket mirrors, if any
+func (s *KeyValueBucketStatus) Mirror() *StreamSourceInfo { return s.nfo.Mirror }
+
+// Sources returns information about the buckets this bucket sources from, if any
+func (s *KeyValueBucketStatus) Sources() []*StreamSourceInfo { return s.nfo.Sources }
+
+// LastRevision is the revision of the last update made to the bucket
+func (s *KeyValueBucketStatus) LastRevision() uint64 { return s.nfo.State.LastSeq }
+
 // StreamInfo is the stream info retrieved to create the status
 func (s *KeyValueBucketStatus) StreamInfo() *StreamInfo { return s.nfo }
 
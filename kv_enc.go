@@ -0,0 +1,190 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// EncodedKeyValue wraps a KeyValue store and utilizes a registered encoder
+// to encode and decode values from Go types.
+//
+// Notice: Experimental Preview
+//
+// This functionality is EXPERIMENTAL and may be changed in later releases.
+type EncodedKeyValue struct {
+	KeyValue KeyValue
+	Enc      Encoder
+}
+
+// NewEncodedKeyValue will wrap an existing KeyValue store and utilize the
+// appropriate registered encoder.
+func NewEncodedKeyValue(kv KeyValue, encType string) (*EncodedKeyValue, error) {
+	if kv == nil {
+		return nil, errors.New("nats: Nil KeyValue")
+	}
+	ekv := &EncodedKeyValue{KeyValue: kv, Enc: EncoderForType(encType)}
+	if ekv.Enc == nil {
+		return nil, fmt.Errorf("no encoder registered for '%s'", encType)
+	}
+	return ekv, nil
+}
+
+// Get returns the latest value for the key, decoded into vPtr.
+func (ekv *EncodedKeyValue) Get(key string, vPtr interface{}) (KeyValueEntry, error) {
+	e, err := ekv.KeyValue.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ekv.Enc.Decode(key, e.Value(), vPtr); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Put will encode v and place it as the new value for the key into the store.
+func (ekv *EncodedKeyValue) Put(key string, v interface{}) (uint64, error) {
+	b, err := ekv.Enc.Encode(key, v)
+	if err != nil {
+		return 0, err
+	}
+	return ekv.KeyValue.Put(key, b)
+}
+
+// Create will encode v and add the key/value pair iff it does not exist.
+func (ekv *EncodedKeyValue) Create(key string, v interface{}) (uint64, error) {
+	b, err := ekv.Enc.Encode(key, v)
+	if err != nil {
+		return 0, err
+	}
+	return ekv.KeyValue.Create(key, b)
+}
+
+// Update will encode v and update the value iff the latest revision matches.
+func (ekv *EncodedKeyValue) Update(key string, v interface{}, last uint64) (uint64, error) {
+	b, err := ekv.Enc.Encode(key, v)
+	if err != nil {
+		return 0, err
+	}
+	return ekv.KeyValue.Update(key, b, last)
+}
+
+// EncodedKeyValueEntry is an update received from an EncodedKeyWatcher.
+type EncodedKeyValueEntry struct {
+	KeyValueEntry
+	// Decoded is a pointer to the decoded value, of the same type than the
+	// pointer given to Watch. It is nil for delete and purge operations, or
+	// if the value could not be decoded.
+	Decoded interface{}
+	// Err is set if the value of this entry could not be decoded.
+	Err error
+}
+
+// EncodedKeyWatcher is what is returned when doing a watch on an EncodedKeyValue.
+type EncodedKeyWatcher interface {
+	// Context returns watcher context optionally provided by nats.Context option.
+	Context() context.Context
+	// Updates returns a channel to read any updates to entries.
+	// A nil entry is sent when all initial values have been received.
+	Updates() <-chan *EncodedKeyValueEntry
+	// Stop will stop this watcher.
+	Stop() error
+}
+
+// Watch for any updates to keys that match the keys argument. Values are
+// decoded into a newly allocated value of the type pointed to by vPtr.
+// A failure to decode a value is reported in the entry's Err field and
+// does not stop the watcher.
+func (ekv *EncodedKeyValue) Watch(keys string, vPtr interface{}, opts ...WatchOpt) (EncodedKeyWatcher, error) {
+	vt := reflect.TypeOf(vPtr)
+	if vt == nil || vt.Kind() != reflect.Ptr {
+		return nil, errors.New("nats: vPtr must be a pointer")
+	}
+	w, err := ekv.KeyValue.Watch(keys, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ew := &encWatcher{
+		w:       w,
+		updates: make(chan *EncodedKeyValueEntry, 256),
+		quit:    make(chan struct{}),
+	}
+	go ew.decodeLoop(ekv.Enc, vt.Elem())
+	return ew, nil
+}
+
+// WatchAll watches all keys, see Watch.
+func (ekv *EncodedKeyValue) WatchAll(vPtr interface{}, opts ...WatchOpt) (EncodedKeyWatcher, error) {
+	return ekv.Watch(AllKeys, vPtr, opts...)
+}
+
+// Implementation for EncodedKeyWatcher
+type encWatcher struct {
+	w       KeyWatcher
+	updates chan *EncodedKeyValueEntry
+	quit    chan struct{}
+	once    sync.Once
+}
+
+func (ew *encWatcher) decodeLoop(enc Encoder, vt reflect.Type) {
+	defer close(ew.updates)
+	for entry := range ew.w.Updates() {
+		var ee *EncodedKeyValueEntry
+		if entry != nil {
+			ee = &EncodedKeyValueEntry{KeyValueEntry: entry}
+			if entry.Operation() == KeyValuePut {
+				v := reflect.New(vt).Interface()
+				if err := enc.Decode(entry.Key(), entry.Value(), v); err != nil {
+					ee.Err = err
+				} else {
+					ee.Decoded = v
+				}
+			}
+		}
+		select {
+		case ew.updates <- ee:
+		case <-ew.quit:
+			return
+		}
+	}
+}
+
+// Context returns the context for the watcher if set.
+func (ew *encWatcher) Context() context.Context {
+	if ew == nil {
+		return nil
+	}
+	return ew.w.Context()
+}
+
+// Updates returns the interior channel.
+func (ew *encWatcher) Updates() <-chan *EncodedKeyValueEntry {
+	if ew == nil {
+		return nil
+	}
+	return ew.updates
+}
+
+// Stop will stop the underlying watcher.
+func (ew *encWatcher) Stop() error {
+	if ew == nil {
+		return nil
+	}
+	ew.once.Do(func() { close(ew.quit) })
+	return ew.w.Stop()
+}
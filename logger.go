@@ -0,0 +1,125 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// LogLevel is the level of an event logged by a Logger.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Keys of the fields of the logged events.
+const (
+	LogFieldServer   = "server"
+	LogFieldAttempt  = "attempt"
+	LogFieldError    = "error"
+	LogFieldSubject  = "subject"
+	LogFieldSid      = "sid"
+	LogFieldStream   = "stream"
+	LogFieldConsumer = "consumer"
+	LogFieldSequence = "sequence"
+)
+
+// LogField is a field of a logged event.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives the events of the connection lifecycle and the internal
+// errors of a connection, see the SetLogger() option. It is called
+// synchronously, possibly with internal locks held, so it must not block nor
+// call the connection.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...LogField)
+}
+
+// SetLogger is an Option to set the Logger of the connection.
+func SetLogger(logger Logger) Option {
+	return func(o *Options) error {
+		o.Logger = logger
+		return nil
+	}
+}
+
+// NewStdLogger returns a Logger writing the events of at least the level min
+// to l, in the format:
+//
+//	[WARN] reconnect attempt failed server=nats://localhost:4222 error="..."
+func NewStdLogger(l *log.Logger, min LogLevel) Logger {
+	return &stdLogger{l: l, min: min}
+}
+
+type stdLogger struct {
+	l   *log.Logger
+	min LogLevel
+}
+
+func (sl *stdLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	if level < sl.min {
+		return
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s] %s", level, msg)
+	for _, f := range fields {
+		if s, ok := f.Value.(string); ok && !strings.ContainsAny(s, " \t\"=") {
+			fmt.Fprintf(&sb, " %s=%s", f.Key, s)
+		} else if err, ok := f.Value.(error); ok {
+			fmt.Fprintf(&sb, " %s=%q", f.Key, err.Error())
+		} else {
+			fmt.Fprintf(&sb, " %s=%#v", f.Key, f.Value)
+		}
+	}
+	sl.l.Print(sb.String())
+}
+
+// log logs an event with the Logger of the connection, if any.
+func (nc *Conn) log(level LogLevel, msg string, fields ...LogField) {
+	if logger := nc.Opts.Logger; logger != nil {
+		logger.Log(level, msg, fields...)
+	}
+}
+
+// serverField returns the field of the URL of a server, without credentials.
+func serverField(s *srv) LogField {
+	if s == nil || s.url == nil {
+		return LogField{LogFieldServer, _EMPTY_}
+	}
+	return LogField{LogFieldServer, s.url.Redacted()}
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// States of a Msg with regard to the pool.
+const (
+	msgNotPooled uint32 = iota
+	msgInUse
+	msgReleased
+)
+
+// maxPooledMsgBuf is the capacity above which the payload buffer of a
+// released message is not kept in the pool.
+const maxPooledMsgBuf = 64 * 1024
+
+var msgPool = sync.Pool{New: func() interface{} { return new(Msg) }}
+
+// PooledMsgs is an Option to receive the messages of the subscriptions in
+// pooled Msg structures and payload buffers, to avoid the allocations of the
+// receive path. Messages should be released with Msg.Release() once
+// processed, after which neither the Msg nor its Data or Header can be used.
+// Messages not released are garbage collected as usual. The messages of
+// JetStream subscriptions are not pooled, since they may be acknowledged after
+// the handler returns.
+//
+// Build with the natsdebug tag to check for invalid releases.
+func PooledMsgs() Option {
+	return func(o *Options) error {
+		o.PooledMsgs = true
+		return nil
+	}
+}
+
+// getPooledMsg returns a message from the pool, with a payload buffer of
+// data copied unless copied is set, in which case data is used directly.
+func getPooledMsg(data []byte, copied bool) *Msg {
+	m := msgPool.Get().(*Msg)
+	m.pool = msgInUse
+	if copied {
+		m.Data = data
+	} else {
+		m.buf = append(m.buf[:0], data...)
+		m.Data = m.buf
+	}
+	return m
+}
+
+// Release returns a message received with the PooledMsgs() option to the
+// pool. The message, its Data and Header must not be used after. It does
+// nothing for other messages, or if the message was already released.
+func (m *Msg) Release() {
+	if m == nil {
+		return
+	}
+	if !atomic.CompareAndSwapUint32(&m.pool, msgInUse, msgReleased) {
+		if msgPoolDebug {
+			if atomic.LoadUint32(&m.pool) == msgReleased {
+				panic("nats: message released twice")
+			}
+			panic("nats: release of a message not from the pool")
+		}
+		return
+	}
+	if msgPoolDebug {
+		for i := range m.buf {
+			m.buf[i] = 0xff
+		}
+		for i := range m.Data {
+			m.Data[i] = 0xff
+		}
+	}
+	// The Subject and Reply are kept to be reused if the next message has
+	// the same ones.
+	m.Header, m.Data, m.Sub = nil, nil, nil
+	m.next, m.barrier = nil, nil
+	atomic.StoreUint32(&m.ackd, 0)
+	if cap(m.buf) > maxPooledMsgBuf {
+		m.buf = nil
+	}
+	msgPool.Put(m)
+}
@@ -0,0 +1,22 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build natsdebug
+// +build natsdebug
+
+package nats
+
+// msgPoolDebug enables the safety checks of the pooled messages: releasing a
+// message twice, or a message not from the pool, panics, and the payload of
+// released messages is overwritten so that uses after release show up.
+const msgPoolDebug = true
@@ -0,0 +1,51 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build natsdebug
+// +build natsdebug
+
+package nats
+
+import (
+	"testing"
+)
+
+func TestPooledMsgsFilteredSlowConsumer(t *testing.T) {
+	s := RunServerOnPort(-1)
+	defer s.Shutdown()
+
+	nc, err := Connect(s.ClientURL(), PooledMsgs(), ErrorHandler(func(*Conn, *Subscription, error) {}))
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	sub.SetPendingLimits(1, -1)
+	// The dropped messages are not from the pool, releasing them would panic.
+	nc.addMsgFilter("foo", func(m *Msg) *Msg {
+		return &Msg{Subject: m.Subject, Data: append([]byte(nil), m.Data...), Sub: m.Sub}
+	})
+	for i := 0; i < 5; i++ {
+		nc.Publish("foo", []byte("hello"))
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error on flush: %v", err)
+	}
+	if dropped, _ := sub.Dropped(); dropped == 0 {
+		t.Fatal("Expected messages to be dropped")
+	}
+}
@@ -17,6 +17,7 @@ package nats
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
@@ -139,6 +140,7 @@ var (
 	ErrNoResponders           = errors.New("nats: no responders available for request")
 	ErrMaxConnectionsExceeded = errors.New("nats: server maximum connections exceeded")
 	ErrConnectionNotTLS       = errors.New("nats: connection is not tls")
+	ErrBadCapture             = errors.New("nats: invalid protocol capture")
 )
 
 func init() {
@@ -430,6 +432,38 @@ type Options struct {
 	// a *net.Dialer).
 	CustomDialer CustomDialer
 
+	// Clock is the source of time used for the timers of the connection.
+	// Defaults to the system clock.
+	Clock Clock
+
+	// Logger receives the events of the connection lifecycle and the
+	// internal errors, see SetLogger().
+	Logger Logger
+
+	// ProtoTraceCB is called for each protocol operation exchanged with
+	// the server, see TraceProtocol().
+	ProtoTraceCB ProtoTraceHandler
+
+	// ProtoTracePayload is the maximum number of bytes of payload traced.
+	ProtoTracePayload int
+
+	// ProtoCapture receives the data exchanged with the server, see
+	// CaptureProtocol().
+	ProtoCapture io.Writer
+
+	// PublishHighWaterMark, if positive, makes publish calls block while
+	// the outbound buffer holds at least that many bytes, see
+	// PublishBackpressure().
+	PublishHighWaterMark int
+
+	// PublishBlockTimeout is the maximum time a publish call without
+	// context blocks, or no limit if 0.
+	PublishBlockTimeout time.Duration
+
+	// PooledMsgs makes received messages come from a pool, see
+	// PooledMsgs().
+	PooledMsgs bool
+
 	// UseOldRequestStyle forces the old method of Requests that utilize
 	// a new Inbox and a new Subscription for each request.
 	UseOldRequestStyle bool
@@ -509,6 +543,7 @@ type Conn struct {
 	bw      *natsWriter
 	br      *natsReader
 	fch     chan struct{}
+	pubWait chan struct{}
 	info    serverInfo
 	ssid    int64
 	subsMu  sync.RWMutex
@@ -520,7 +555,7 @@ type Conn struct {
 	initc   bool // true if the connection is performing the initial connect
 	err     error
 	ps      *parseState
-	ptmr    *time.Timer
+	ptmr    Timer
 	pout    int
 	ar      bool // abort reconnect
 	rqch    chan struct{}
@@ -538,13 +573,18 @@ type Conn struct {
 	// Msg filters for testing.
 	// Protected by subsMu
 	filters map[string]msgFilter
+
+	// Channels receiving the connection events.
+	evMu   sync.Mutex
+	evSubs map[*ConnEventSubscription]struct{}
 }
 
 type natsReader struct {
-	r   io.Reader
-	buf []byte
-	off int
-	n   int
+	r      io.Reader
+	buf    []byte
+	off    int
+	n      int
+	tracer *protoTracer
 }
 
 type natsWriter struct {
@@ -553,6 +593,7 @@ type natsWriter struct {
 	limit   int
 	pending *bytes.Buffer
 	plimit  int
+	tracer  *protoTracer
 }
 
 // Subscription represents interest in a given subject.
@@ -572,6 +613,11 @@ type Subscription struct {
 	// For holding information about a JetStream consumer.
 	jsi *jsSub
 
+	// Whether received messages come from the pool, see PooledMsgs(). Not
+	// for JetStream subscriptions, whose messages are acknowledged after
+	// the callback returns. Immutable.
+	pooled bool
+
 	delivered  uint64
 	max        uint64
 	conn       *Conn
@@ -598,6 +644,12 @@ type Subscription struct {
 	pMsgsLimit  int
 	pBytesLimit int
 	dropped     int
+
+	// Overflow policy, see sub_overflow.go
+	ovfPolicy OverflowPolicy
+	ovfStats  OverflowStats
+	ovfLast   map[string]*Msg
+	spill     *subSpill
 }
 
 // Msg represents a message delivered by NATS. This structure is used
@@ -627,6 +679,9 @@ type Msg struct {
 	next    *Msg
 	barrier *barrierInfo
 	ackd    uint32
+	// Pool state and payload buffer, see PooledMsgs().
+	pool uint32
+	buf  []byte
 }
 
 func (m *Msg) headerBytes() ([]byte, error) {
@@ -1133,6 +1188,15 @@ func SetCustomDialer(dialer CustomDialer) Option {
 	}
 }
 
+// SetClock is an Option to set the Clock used for the timers of the
+// connection, for instance to control time in tests.
+func SetClock(clock Clock) Option {
+	return func(o *Options) error {
+		o.Clock = clock
+		return nil
+	}
+}
+
 // UseOldRequestStyle is an Option to force usage of the old Request style.
 func UseOldRequestStyle() Option {
 	return func(o *Options) error {
@@ -1601,13 +1665,16 @@ func (nc *Conn) shufflePool(offset int) {
 }
 
 func (nc *Conn) newReaderWriter() {
+	tracer := newProtoTracer(&nc.Opts)
 	nc.br = &natsReader{
-		buf: make([]byte, defaultBufSize),
-		off: -1,
+		buf:    make([]byte, defaultBufSize),
+		off:    -1,
+		tracer: tracer,
 	}
 	nc.bw = &natsWriter{
 		limit:  defaultBufSize,
 		plimit: nc.Opts.ReconnectBufSize,
+		tracer: tracer,
 	}
 }
 
@@ -1616,6 +1683,9 @@ func (nc *Conn) bindToNewConn() {
 	bw.w, bw.bufs = nc.newWriter(), nil
 	br := nc.br
 	br.r, br.n, br.off = nc.conn, 0, -1
+	if br.tracer != nil {
+		br.tracer.reset()
+	}
 }
 
 func (nc *Conn) newWriter() io.Writer {
@@ -1649,6 +1719,9 @@ func (w *natsWriter) appendBufs(bufs ...[]byte) error {
 
 func (w *natsWriter) writeDirect(strs ...string) error {
 	for _, str := range strs {
+		if w.tracer != nil {
+			w.tracer.outbound([]byte(str))
+		}
 		if _, err := w.w.Write([]byte(str)); err != nil {
 			return err
 		}
@@ -1656,6 +1729,28 @@ func (w *natsWriter) writeDirect(strs ...string) error {
 	return nil
 }
 
+// writeBuffers writes the buffered data followed by bufs, without copying
+// bufs when the writer supports vectored writes. With a pending buffer, bufs
+// are appended to it.
+func (w *natsWriter) writeBuffers(bufs net.Buffers) error {
+	if w.pending != nil {
+		return w.appendBufs(bufs...)
+	}
+	if w.tracer != nil {
+		data := append([]byte(nil), w.bufs...)
+		for _, buf := range bufs {
+			data = append(data, buf...)
+		}
+		w.tracer.outbound(data)
+	}
+	if len(w.bufs) > 0 {
+		bufs = append(net.Buffers{w.bufs}, bufs...)
+	}
+	_, err := bufs.WriteTo(w.w)
+	w.bufs = w.bufs[:0]
+	return err
+}
+
 func (w *natsWriter) flush() error {
 	// If a pending buffer is set, we don't flush. Code that needs to
 	// write directly to the socket, by-passing buffers during (re)connect,
@@ -1666,6 +1761,9 @@ func (w *natsWriter) flush() error {
 	// Do not skip calling w.w.Write() here if len(w.bufs) is 0 because
 	// the actual writer (if websocket for instance) may have things
 	// to do such as sending control frames, etc..
+	if w.tracer != nil {
+		w.tracer.outbound(w.bufs)
+	}
 	_, err := w.w.Write(w.bufs)
 	w.bufs = w.bufs[:0]
 	return err
@@ -1686,6 +1784,9 @@ func (w *natsWriter) flushPendingBuffer() error {
 	if w.pending == nil || w.pending.Len() == 0 {
 		return nil
 	}
+	if w.tracer != nil {
+		w.tracer.outbound(w.pending.Bytes())
+	}
 	_, err := w.w.Write(w.pending.Bytes())
 	// Reset the pending buffer at this point because we don't want
 	// to take the risk of sending duplicates or partials.
@@ -1723,6 +1824,9 @@ func (r *natsReader) Read() ([]byte, error) {
 	}
 	var err error
 	r.n, err = r.r.Read(r.buf)
+	if r.tracer != nil && r.n > 0 {
+		r.tracer.inbound(r.buf[:r.n])
+	}
 	return r.buf[:r.n], err
 }
 
@@ -1847,6 +1951,7 @@ func (nc *Conn) makeTLSConn() error {
 	nc.conn = tls.Client(nc.conn, tlsCopy)
 	conn := nc.conn.(*tls.Conn)
 	if err := conn.Handshake(); err != nil {
+		nc.log(LogError, "tls handshake failed", serverField(nc.current), LogField{LogFieldError, err})
 		return err
 	}
 	nc.bindToNewConn()
@@ -2062,7 +2167,7 @@ func (nc *Conn) processConnectInit() error {
 	// Start or reset Timer
 	if nc.Opts.PingInterval > 0 {
 		if nc.ptmr == nil {
-			nc.ptmr = time.AfterFunc(nc.Opts.PingInterval, nc.processPingTimer)
+			nc.ptmr = nc.Opts.clock().AfterFunc(nc.Opts.PingInterval, nc.processPingTimer)
 		} else {
 			nc.ptmr.Reset(nc.Opts.PingInterval)
 		}
@@ -2105,8 +2210,10 @@ func (nc *Conn) connect() error {
 				nc.current.didConnect = true
 				nc.current.reconnects = 0
 				nc.current.lastErr = nil
+				nc.log(LogInfo, "connected", serverField(nc.current))
 				break
 			} else {
+				nc.log(LogWarn, "connect failed", serverField(nc.current), LogField{LogFieldError, err})
 				nc.mu.Unlock()
 				nc.close(DISCONNECTED, false, err)
 				nc.mu.Lock()
@@ -2115,6 +2222,7 @@ func (nc *Conn) connect() error {
 				// to try before starting doReconnect().
 			}
 		} else {
+			nc.log(LogWarn, "connect failed", serverField(nc.current), LogField{LogFieldError, err})
 			// Cancel out default connection refused, will trigger the
 			// No servers error conditional
 			if strings.Contains(err.Error(), "connection refused") {
@@ -2394,7 +2502,9 @@ func parseControl(line string, c *control) {
 // flushReconnectPendingItems will push the pending items that were
 // gathered while we were in a RECONNECTING state to the socket.
 func (nc *Conn) flushReconnectPendingItems() error {
-	return nc.bw.flushPendingBuffer()
+	err := nc.bw.flushPendingBuffer()
+	nc.releasePublishers()
+	return err
 }
 
 // Stops the ping timer if set.
@@ -2430,12 +2540,13 @@ func (nc *Conn) doReconnect(err error) {
 		} else if nc.Opts.DisconnectedCB != nil {
 			nc.ach.push(func() { nc.Opts.DisconnectedCB(nc) })
 		}
+		nc.pushEvent(ConnEventDisconnected, err, nil)
 	}
 
 	// This is used to wait on go routines exit if we start them in the loop
 	// but an error occurs after that.
 	waitForGoRoutines := false
-	var rt *time.Timer
+	var rt Timer
 	// Channel used to kick routine out of sleep when conn is closed.
 	rqch := nc.rqch
 	// Counter that is increased when the whole list of servers has been tried.
@@ -2483,14 +2594,14 @@ func (nc *Conn) doReconnect(err error) {
 				}
 			}
 			if rt == nil {
-				rt = time.NewTimer(st)
+				rt = nc.Opts.clock().NewTimer(st)
 			} else {
 				rt.Reset(st)
 			}
 			select {
 			case <-rqch:
 				rt.Stop()
-			case <-rt.C:
+			case <-rt.C():
 			}
 		}
 		// If the readLoop, etc.. go routines were started, wait for them to complete.
@@ -2507,6 +2618,7 @@ func (nc *Conn) doReconnect(err error) {
 
 		// Mark that we tried a reconnect
 		cur.reconnects++
+		nc.log(LogDebug, "reconnect attempt", serverField(cur), LogField{LogFieldAttempt, cur.reconnects})
 
 		// Try to create a new connection
 		err = nc.createConn()
@@ -2514,6 +2626,7 @@ func (nc *Conn) doReconnect(err error) {
 		// Not yet connected, retry...
 		// Continue to hold the lock
 		if err != nil {
+			nc.log(LogWarn, "reconnect attempt failed", serverField(cur), LogField{LogFieldAttempt, cur.reconnects}, LogField{LogFieldError, err})
 			nc.err = nil
 			continue
 		}
@@ -2523,6 +2636,7 @@ func (nc *Conn) doReconnect(err error) {
 
 		// Process connect logic
 		if nc.err = nc.processConnectInit(); nc.err != nil {
+			nc.log(LogWarn, "reconnect attempt failed", serverField(cur), LogField{LogFieldAttempt, cur.reconnects}, LogField{LogFieldError, nc.err})
 			// Check if we should abort reconnect. If so, break out
 			// of the loop and connection will be closed.
 			if nc.ar {
@@ -2561,6 +2675,7 @@ func (nc *Conn) doReconnect(err error) {
 
 		// This is where we are truly connected.
 		nc.status = CONNECTED
+		nc.log(LogInfo, "reconnected", serverField(cur))
 
 		// If we are here with a retry on failed connect, indicate that the
 		// initial connect is now complete.
@@ -2570,6 +2685,7 @@ func (nc *Conn) doReconnect(err error) {
 		if nc.Opts.ReconnectedCB != nil {
 			nc.ach.push(func() { nc.Opts.ReconnectedCB(nc) })
 		}
+		nc.pushEvent(ConnEventReconnected, nil, nil)
 
 		// Release lock here, we will return below.
 		nc.mu.Unlock()
@@ -2597,6 +2713,7 @@ func (nc *Conn) processOpErr(err error) {
 		return
 	}
 
+	nc.log(LogWarn, "disconnected", serverField(nc.current), LogField{LogFieldError, err})
 	if nc.Opts.AllowReconnect && nc.status == CONNECTED {
 		// Set our new status
 		nc.status = RECONNECTING
@@ -2609,6 +2726,7 @@ func (nc *Conn) processOpErr(err error) {
 
 		// Create pending buffer before reconnecting.
 		nc.bw.switchToPending()
+		nc.releasePublishers()
 
 		// Clear any queued pongs, e.g. pending flush calls.
 		nc.clearPendingFlushCalls()
@@ -2747,8 +2865,23 @@ func (nc *Conn) waitForMsgs(s *Subscription) {
 			msgLen = -1
 		}
 
+		// Reload the spilled messages once the list is empty.
+		if s.pHead == nil && !s.closed && s.spill != nil && s.spill.n > 0 {
+			if err := s.unspill(); err != nil {
+				s.mu.Unlock()
+				nc.mu.Lock()
+				nc.pushAsyncErr(s, err)
+				nc.mu.Unlock()
+				continue
+			}
+		}
 		if s.pHead == nil && !s.closed {
 			s.pCond.Wait()
+			// Woken up by the spill writer, check the spilled messages again.
+			if s.pHead == nil && !s.closed && s.spill != nil && s.spill.n > 0 {
+				s.mu.Unlock()
+				continue
+			}
 		}
 		// Pop the msg off the list
 		m := s.pHead
@@ -2757,6 +2890,9 @@ func (nc *Conn) waitForMsgs(s *Subscription) {
 			if s.pHead == nil {
 				s.pTail = nil
 			}
+			if s.ovfLast != nil && s.ovfLast[m.Subject] == m {
+				delete(s.ovfLast, m.Subject)
+			}
 			if m.barrier != nil {
 				s.mu.Unlock()
 				if atomic.AddInt64(&m.barrier.refs, -1) == 0 {
@@ -2812,6 +2948,9 @@ func (nc *Conn) waitForMsgs(s *Subscription) {
 		}
 		s.pHead = m.next
 	}
+	if s.spill != nil {
+		s.spill.close()
+	}
 	// Now check for pDone
 	done := s.pDone
 	s.mu.Unlock()
@@ -2871,18 +3010,31 @@ func (nc *Conn) processMsg(data []byte) {
 		return
 	}
 
-	// Copy them into string
-	subj := string(nc.ps.ma.subject)
-	reply := string(nc.ps.ma.reply)
-
 	// Doing message create outside of the sub's lock to reduce contention.
 	// It's possible that we end-up not using the message, but that's ok.
-
-	// FIXME(dlc): Need to copy, should/can do COW?
-	var msgPayload = data
-	if !nc.ps.msgCopied {
-		msgPayload = make([]byte, len(data))
-		copy(msgPayload, data)
+	var m, pm *Msg
+	var msgPayload []byte
+	if sub.pooled {
+		m = getPooledMsg(data, nc.ps.msgCopied)
+		pm = m
+		msgPayload = m.Data
+		// Reuse the subject and reply of the previous use of the message,
+		// if identical, to avoid allocating them.
+		if m.Subject != string(nc.ps.ma.subject) {
+			m.Subject = string(nc.ps.ma.subject)
+		}
+		if m.Reply != string(nc.ps.ma.reply) {
+			m.Reply = string(nc.ps.ma.reply)
+		}
+	} else {
+		// FIXME(dlc): Need to copy, should/can do COW?
+		msgPayload = data
+		if !nc.ps.msgCopied {
+			msgPayload = make([]byte, len(data))
+			copy(msgPayload, data)
+		}
+		// Copy them into string
+		m = &Msg{Subject: string(nc.ps.ma.subject), Reply: string(nc.ps.ma.reply)}
 	}
 
 	// Check if we have headers encoded here.
@@ -2891,6 +3043,7 @@ func (nc *Conn) processMsg(data []byte) {
 	var ctrlMsg bool
 	var ctrlType int
 	var fcReply string
+	var spillFull bool
 
 	if nc.ps.ma.hdr > 0 {
 		hbuf := msgPayload[:nc.ps.ma.hdr]
@@ -2900,15 +3053,12 @@ func (nc *Conn) processMsg(data []byte) {
 			// We will pass the message through but send async error.
 			nc.mu.Lock()
 			nc.err = ErrBadHeaderMsg
-			if nc.Opts.AsyncErrorCB != nil {
-				nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, sub, ErrBadHeaderMsg) })
-			}
+			nc.pushAsyncErr(sub, ErrBadHeaderMsg)
 			nc.mu.Unlock()
 		}
 	}
 
-	// FIXME(dlc): Should we recycle these containers?
-	m := &Msg{Header: h, Data: msgPayload, Subject: subj, Reply: reply, Sub: sub}
+	m.Header, m.Data, m.Sub = h, msgPayload, sub
 
 	// Check for message filters.
 	if mf != nil {
@@ -2961,8 +3111,19 @@ func (nc *Conn) processMsg(data []byte) {
 			}
 
 			// Check for a Slow Consumer
-			if (sub.pMsgsLimit > 0 && sub.pMsgs > sub.pMsgsLimit) ||
-				(sub.pBytesLimit > 0 && sub.pBytes > sub.pBytesLimit) {
+			if sub.ovfPolicy != OverflowDropNewest || sub.spill != nil {
+				switch sub.applyOverflowPolicy(m) {
+				case ovfDrop:
+					goto slowConsumer
+				case ovfSpillFull:
+					spillFull = true
+					goto slowConsumer
+				case ovfQueued:
+					sub.sc = false
+					sub.mu.Unlock()
+					return
+				}
+			} else if sub.overLimits() {
 				goto slowConsumer
 			}
 		} else if jsi != nil {
@@ -2975,7 +3136,9 @@ func (nc *Conn) processMsg(data []byte) {
 			select {
 			case sub.mch <- m:
 			default:
-				goto slowConsumer
+				if !sub.sendDroppingOldest(m) {
+					goto slowConsumer
+				}
 			}
 		} else {
 			// Push onto the async pList
@@ -3034,6 +3197,11 @@ func (nc *Conn) processMsg(data []byte) {
 
 slowConsumer:
 	sub.dropped++
+	if spillFull {
+		sub.ovfStats.SpillDropped++
+	} else {
+		sub.ovfStats.DroppedNewest++
+	}
 	sc := !sub.sc
 	sub.sc = true
 	// Undo stats from above
@@ -3042,15 +3210,18 @@ slowConsumer:
 		sub.pBytes -= len(m.Data)
 	}
 	sub.mu.Unlock()
+	// Only release the message from the pool, not one returned by a filter.
+	if m == pm {
+		pm.Release()
+	}
 	if sc {
 		// Now we need connection's lock and we may end-up in the situation
 		// that we were trying to avoid, except that in this case, the client
 		// is already experiencing client-side slow consumer situation.
 		nc.mu.Lock()
 		nc.err = ErrSlowConsumer
-		if nc.Opts.AsyncErrorCB != nil {
-			nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, sub, ErrSlowConsumer) })
-		}
+		nc.log(LogWarn, "slow consumer, messages dropped", LogField{LogFieldSubject, sub.Subject}, LogField{LogFieldSid, sub.sid})
+		nc.pushAsyncErr(sub, ErrSlowConsumer)
 		nc.mu.Unlock()
 	}
 }
@@ -3062,9 +3233,7 @@ func (nc *Conn) processPermissionsViolation(err string) {
 	// create error here so we can pass it as a closure to the async cb dispatcher.
 	e := errors.New("nats: " + err)
 	nc.err = e
-	if nc.Opts.AsyncErrorCB != nil {
-		nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, nil, e) })
-	}
+	nc.pushAsyncErr(nil, e)
 	nc.mu.Unlock()
 }
 
@@ -3075,8 +3244,9 @@ func (nc *Conn) processPermissionsViolation(err string) {
 // Connection lock is held on entry
 func (nc *Conn) processAuthError(err error) bool {
 	nc.err = err
-	if !nc.initc && nc.Opts.AsyncErrorCB != nil {
-		nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, nil, err) })
+	nc.log(LogError, "authentication error", serverField(nc.current), LogField{LogFieldError, err})
+	if !nc.initc {
+		nc.pushAsyncErr(nil, err)
 	}
 	// We should give up if we tried twice on this server and got the
 	// same error.
@@ -3118,14 +3288,14 @@ func (nc *Conn) flusher() {
 		}
 		if bw.buffered() > 0 {
 			if err := bw.flush(); err != nil {
+				nc.log(LogError, "flush failed", serverField(nc.current), LogField{LogFieldError, err})
 				if nc.err == nil {
 					nc.err = err
 				}
-				if nc.Opts.AsyncErrorCB != nil {
-					nc.ach.push(func() { nc.Opts.AsyncErrorCB(nc, nil, err) })
-				}
+				nc.pushAsyncErr(nil, err)
 			}
 		}
+		nc.releasePublishers()
 		nc.mu.Unlock()
 	}
 }
@@ -3177,8 +3347,8 @@ func (nc *Conn) processInfo(info string) error {
 	// did not include themselves in the async INFO protocol.
 	// If empty, do not remove the implicit servers from the pool.
 	if len(nc.info.ConnectURLs) == 0 {
-		if !nc.initc && ncInfo.LameDuckMode && nc.Opts.LameDuckModeHandler != nil {
-			nc.ach.push(func() { nc.Opts.LameDuckModeHandler(nc) })
+		if !nc.initc && ncInfo.LameDuckMode {
+			nc.pushLameDuckMode()
 		}
 		return nil
 	}
@@ -3236,16 +3406,29 @@ func (nc *Conn) processInfo(info string) error {
 		if !nc.Opts.NoRandomize {
 			nc.shufflePool(1)
 		}
-		if !nc.initc && nc.Opts.DiscoveredServersCB != nil {
-			nc.ach.push(func() { nc.Opts.DiscoveredServersCB(nc) })
+		if !nc.initc {
+			if nc.Opts.DiscoveredServersCB != nil {
+				nc.ach.push(func() { nc.Opts.DiscoveredServersCB(nc) })
+			}
+			nc.pushEvent(ConnEventDiscoveredServers, nil, nil)
 		}
 	}
-	if !nc.initc && ncInfo.LameDuckMode && nc.Opts.LameDuckModeHandler != nil {
-		nc.ach.push(func() { nc.Opts.LameDuckModeHandler(nc) })
+	if !nc.initc && ncInfo.LameDuckMode {
+		nc.pushLameDuckMode()
 	}
 	return nil
 }
 
+// pushLameDuckMode queues the notification of the lame duck mode of the
+// server.
+// Connection lock is held on entry.
+func (nc *Conn) pushLameDuckMode() {
+	if nc.Opts.LameDuckModeHandler != nil {
+		nc.ach.push(func() { nc.Opts.LameDuckModeHandler(nc) })
+	}
+	nc.pushEvent(ConnEventLameDuckMode, nil, nil)
+}
+
 // processAsyncInfo does the same than processInfo, but is called
 // from the parser. Calls processInfo under connection's lock
 // protection.
@@ -3493,6 +3676,13 @@ const digits = "0123456789"
 // Sends a protocol data message by queuing into the bufio writer
 // and kicking the flush go routine. These writes should be protected.
 func (nc *Conn) publish(subj, reply string, hdr, data []byte) error {
+	return nc.publishWithContext(nil, subj, reply, hdr, data)
+}
+
+// publishWithContext publishes the message, waiting until ctx is done for the
+// outbound buffer to fall below the high-water mark, if set. Without context,
+// the wait is bounded by the PublishBlockTimeout option.
+func (nc *Conn) publishWithContext(ctx context.Context, subj, reply string, hdr, data []byte) error {
 	if nc == nil {
 		return ErrInvalidConnection
 	}
@@ -3525,6 +3715,14 @@ func (nc *Conn) publish(subj, reply string, hdr, data []byte) error {
 		return ErrMaxPayload
 	}
 
+	// Slow down to the pace of the network if backpressure is enabled.
+	if nc.Opts.PublishHighWaterMark > 0 && nc.bw.buffered() >= nc.Opts.PublishHighWaterMark {
+		if err := nc.waitForPublishBuffer(ctx, 0); err != nil {
+			nc.mu.Unlock()
+			return err
+		}
+	}
+
 	// Check if we are reconnecting, and if so check if
 	// we have exceeded our reconnect outbound buffer limits.
 	if nc.bw.atLimitIfUsingPending() {
@@ -3532,6 +3730,27 @@ func (nc *Conn) publish(subj, reply string, hdr, data []byte) error {
 		return ErrReconnectBufExceeded
 	}
 
+	mh := nc.pubProto(subj, reply, hdr, msgSize)
+
+	if err := nc.bw.appendBufs(mh, hdr, data, _CRLF_BYTES_); err != nil {
+		nc.mu.Unlock()
+		return err
+	}
+
+	nc.OutMsgs++
+	nc.OutBytes += uint64(len(data) + len(hdr))
+
+	if len(nc.fch) == 0 {
+		nc.kickFlusher()
+	}
+	nc.mu.Unlock()
+	return nil
+}
+
+// pubProto returns the PUB, or HPUB if hdr is not nil, protocol line of a
+// message. The returned slice is only valid until the next call.
+// Connection lock is held on entry.
+func (nc *Conn) pubProto(subj, reply string, hdr []byte, msgSize int64) []byte {
 	var mh []byte
 	if hdr != nil {
 		mh = nc.scratch[:len(_HPUB_P_)]
@@ -3582,20 +3801,7 @@ func (nc *Conn) publish(subj, reply string, hdr, data []byte) error {
 
 	mh = append(mh, b[i:]...)
 	mh = append(mh, _CRLF_...)
-
-	if err := nc.bw.appendBufs(mh, hdr, data, _CRLF_BYTES_); err != nil {
-		nc.mu.Unlock()
-		return err
-	}
-
-	nc.OutMsgs++
-	nc.OutBytes += uint64(len(data) + len(hdr))
-
-	if len(nc.fch) == 0 {
-		nc.kickFlusher()
-	}
-	nc.mu.Unlock()
-	return nil
+	return mh
 }
 
 // respHandler is the global response handler. It will look up
@@ -3728,8 +3934,8 @@ func (nc *Conn) newRequest(subj string, hdr, data []byte, timeout time.Duration)
 		return nil, err
 	}
 
-	t := globalTimerPool.Get(timeout)
-	defer globalTimerPool.Put(t)
+	t := nc.getTimer(timeout)
+	defer nc.putTimer(t)
 
 	var ok bool
 	var msg *Msg
@@ -3739,7 +3945,7 @@ func (nc *Conn) newRequest(subj string, hdr, data []byte, timeout time.Duration)
 		if !ok {
 			return nil, ErrConnectionClosed
 		}
-	case <-t.C:
+	case <-t.C():
 		nc.mu.Lock()
 		delete(nc.respMap, token)
 		nc.mu.Unlock()
@@ -3979,6 +4185,7 @@ func (nc *Conn) subscribeLocked(subj, queue string, cb MsgHandler, ch chan *Msg,
 		mcb:     cb,
 		conn:    nc,
 		jsi:     js,
+		pooled:  nc.Opts.PooledMsgs && js == nil,
 	}
 	// Set pending limits.
 	if ch != nil {
@@ -4201,9 +4408,7 @@ func (nc *Conn) checkDrained(sub *Subscription) {
 			if dc {
 				if err := sub.deleteConsumer(); err != nil {
 					nc.mu.Lock()
-					if errCB := nc.Opts.AsyncErrorCB; errCB != nil {
-						nc.ach.push(func() { errCB(nc, sub, err) })
-					}
+					nc.pushAsyncErr(sub, err)
 					nc.mu.Unlock()
 				}
 			}
@@ -4310,6 +4515,7 @@ func (s *Subscription) NextMsg(timeout time.Duration) (*Msg, error) {
 
 	// snapshot
 	mch := s.mch
+	nc := s.conn
 	s.mu.Unlock()
 
 	var ok bool
@@ -4332,8 +4538,8 @@ func (s *Subscription) NextMsg(timeout time.Duration) (*Msg, error) {
 	// If we are here a message was not immediately available, so lets loop
 	// with a timeout.
 
-	t := globalTimerPool.Get(timeout)
-	defer globalTimerPool.Put(t)
+	t := nc.getTimer(timeout)
+	defer nc.putTimer(t)
 
 	select {
 	case msg, ok = <-mch:
@@ -4343,7 +4549,7 @@ func (s *Subscription) NextMsg(timeout time.Duration) (*Msg, error) {
 		if err := s.processNextMsgDelivered(msg); err != nil {
 			return nil, err
 		}
-	case <-t.C:
+	case <-t.C():
 		return nil, ErrTimeout
 	}
 
@@ -4664,8 +4870,8 @@ func (nc *Conn) FlushTimeout(timeout time.Duration) (err error) {
 		nc.mu.Unlock()
 		return ErrConnectionClosed
 	}
-	t := globalTimerPool.Get(timeout)
-	defer globalTimerPool.Put(t)
+	t := nc.getTimer(timeout)
+	defer nc.putTimer(t)
 
 	// Create a buffered channel to prevent chan send to block
 	// in processPong() if this code here times out just when
@@ -4681,7 +4887,7 @@ func (nc *Conn) FlushTimeout(timeout time.Duration) (err error) {
 		} else {
 			close(ch)
 		}
-	case <-t.C:
+	case <-t.C():
 		err = ErrTimeout
 	}
 
@@ -4699,11 +4905,12 @@ func (nc *Conn) RTT() (time.Duration, error) {
 	if nc.IsReconnecting() {
 		return 0, ErrDisconnected
 	}
-	start := time.Now()
+	clock := nc.Opts.clock()
+	start := clock.Now()
 	if err := nc.FlushTimeout(10 * time.Second); err != nil {
 		return 0, err
 	}
-	return time.Since(start), nil
+	return clock.Now().Sub(start), nil
 }
 
 // Flush will perform a round trip to the server and return when it
@@ -4802,6 +5009,7 @@ func (nc *Conn) close(status Status, doCBs bool, err error) {
 
 	// Kick the Go routines so they fall out.
 	nc.kickFlusher()
+	nc.releasePublishers()
 
 	// If the reconnect timer is waiting between a reconnect attempt,
 	// this will kick it out.
@@ -4858,6 +5066,9 @@ func (nc *Conn) close(status Status, doCBs bool, err error) {
 	nc.subsMu.Unlock()
 
 	nc.status = status
+	if status == CLOSED {
+		nc.log(LogInfo, "connection closed", serverField(nc.current))
+	}
 
 	// Perform appropriate callback if needed for a disconnect.
 	if doCBs {
@@ -4867,10 +5078,12 @@ func (nc *Conn) close(status Status, doCBs bool, err error) {
 			} else if nc.Opts.DisconnectedCB != nil {
 				nc.ach.push(func() { nc.Opts.DisconnectedCB(nc) })
 			}
+			nc.pushEvent(ConnEventDisconnected, err, nil)
 		}
 		if nc.Opts.ClosedCB != nil {
 			nc.ach.push(func() { nc.Opts.ClosedCB(nc) })
 		}
+		nc.pushEvent(ConnEventClosed, nc.err, nil)
 	}
 	// If this is terminal, then we have to notify the asyncCB handler that
 	// it can exit once all async callbacks have been dispatched.
@@ -4942,7 +5155,6 @@ func (nc *Conn) drainConnection() {
 		}
 		subs = append(subs, s)
 	}
-	errCB := nc.Opts.AsyncErrorCB
 	drainWait := nc.Opts.DrainTimeout
 	respMux := nc.respMux
 	nc.mu.Unlock()
@@ -4951,9 +5163,7 @@ func (nc *Conn) drainConnection() {
 	pushErr := func(err error) {
 		nc.mu.Lock()
 		nc.err = err
-		if errCB != nil {
-			nc.ach.push(func() { errCB(nc, nil, err) })
-		}
+		nc.pushAsyncErr(nil, err)
 		nc.mu.Unlock()
 	}
 
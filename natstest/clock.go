@@ -0,0 +1,171 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package natstest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// FakeClock is a nats.Clock whose time only passes when advanced, so that
+// tests of timeouts, reconnects and heartbeats run instantly:
+//
+//	clock := natstest.NewFakeClock(time.Now())
+//	nc, err := nats.Connect(url, nats.SetClock(clock))
+//	...
+//	clock.Advance(time.Minute)
+type FakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+}
+
+// NewFakeClock returns a FakeClock set at the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now, timers: make(map[*fakeTimer]struct{})}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a timer sending the time of the clock on its channel once
+// the clock is advanced past the duration.
+func (c *FakeClock) NewTimer(d time.Duration) nats.Timer {
+	return c.newTimer(d, make(chan time.Time, 1), nil)
+}
+
+// AfterFunc returns a timer calling f once the clock is advanced past the
+// duration. Unlike with the time package, f is called by Advance, so that it
+// has completed when Advance returns.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) nats.Timer {
+	return c.newTimer(d, nil, f)
+}
+
+func (c *FakeClock) newTimer(d time.Duration, ch chan time.Time, f func()) *fakeTimer {
+	t := &fakeTimer{clock: c, ch: ch, f: f}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the time of the clock forward, firing the timers expiring
+// in that period in the order of their expiration.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		var next *fakeTimer
+		for t := range c.timers {
+			if !t.when.After(end) && (next == nil || t.when.Before(next.when)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		delete(c.timers, next)
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		now := c.now
+		c.mu.Unlock()
+		next.fire(now)
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// NumTimers returns the number of active timers.
+func (c *FakeClock) NumTimers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// WaitForTimers waits for at least n timers to be active, returning false if
+// this does not happen within the timeout, measured with the wall clock. It
+// is used to make sure that the code under test has set its timers before
+// advancing the clock.
+func (c *FakeClock) WaitForTimers(n int, timeout time.Duration) bool {
+	wake := time.AfterFunc(timeout, func() {
+		c.mu.Lock()
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer wake.Stop()
+	deadline := time.Now().Add(timeout)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		c.cond.Wait()
+	}
+	return true
+}
+
+// fakeTimer is a timer of a FakeClock.
+type fakeTimer struct {
+	clock *FakeClock
+	ch    chan time.Time
+	f     func()
+	// Protected by the clock lock.
+	when time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, active := c.timers[t]
+	t.when = c.now.Add(d)
+	c.timers[t] = struct{}{}
+	c.cond.Broadcast()
+	return active
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, active := c.timers[t]
+	delete(c.timers, t)
+	return active
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.f != nil {
+		t.f()
+		return
+	}
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
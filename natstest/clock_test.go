@@ -0,0 +1,144 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package natstest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/natstest"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := natstest.NewFakeClock(start)
+
+	fired := make(chan struct{}, 1)
+	t1 := clock.NewTimer(2 * time.Second)
+	clock.AfterFunc(time.Second, func() { fired <- struct{}{} })
+	t3 := clock.NewTimer(time.Second)
+	if !t3.Stop() || t3.Stop() {
+		t.Fatal("Unexpected result of Stop")
+	}
+
+	clock.Advance(1500 * time.Millisecond)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("AfterFunc timer did not fire")
+	}
+	select {
+	case <-t1.C():
+		t.Fatal("Timer fired too early")
+	case <-t3.C():
+		t.Fatal("Stopped timer fired")
+	default:
+	}
+	clock.Advance(time.Second)
+	if now := <-t1.C(); !now.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("Unexpected time of the timer: %v", now)
+	}
+	if now := clock.Now(); !now.Equal(start.Add(2500 * time.Millisecond)) {
+		t.Fatalf("Unexpected time: %v", now)
+	}
+	if n := clock.NumTimers(); n != 0 {
+		t.Fatalf("Expected no active timer, got %d", n)
+	}
+
+	// Callbacks run in the order of their expiration, before Advance returns.
+	var order []int
+	for _, i := range []int{3, 1, 2} {
+		i := i
+		clock.AfterFunc(time.Duration(i)*time.Second, func() { order = append(order, i) })
+	}
+	clock.Advance(3 * time.Second)
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Fatalf("Unexpected order of the callbacks: %v", order)
+	}
+}
+
+func TestFakeClockConn(t *testing.T) {
+	s := natstest.NewServer()
+	defer s.Shutdown()
+	clock := natstest.NewFakeClock(time.Now())
+
+	disconnected := make(chan struct{}, 1)
+	reconnected := make(chan struct{}, 1)
+	nc, err := nats.Connect(s.ClientURL(),
+		nats.InProcessServer(s),
+		nats.SetClock(clock),
+		nats.PingInterval(time.Minute),
+		nats.ReconnectWait(time.Hour),
+		nats.DisconnectErrHandler(func(*nats.Conn, error) { disconnected <- struct{}{} }),
+		nats.ReconnectHandler(func(*nats.Conn) { reconnected <- struct{}{} }),
+	)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer nc.Close()
+	if _, err := s.WaitFor(natstest.OpPing, "", time.Second); err != nil {
+		t.Fatalf("Error waiting for the PING of the connect: %v", err)
+	}
+
+	// The ping timer.
+	if !clock.WaitForTimers(1, time.Second) {
+		t.Fatal("Ping timer not set")
+	}
+	clock.Advance(time.Minute)
+	if _, err := s.WaitFor(natstest.OpPing, "", time.Second); err != nil {
+		t.Fatalf("Error waiting for the PING of the ping timer: %v", err)
+	}
+
+	// Request timeout, in addition to the ping timer.
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := nc.Request("no.responder", nil, time.Hour)
+		errCh <- err
+	}()
+	if !clock.WaitForTimers(2, time.Second) {
+		t.Fatal("Request timer not set")
+	}
+	clock.Advance(time.Hour)
+	select {
+	case err := <-errCh:
+		if err != nats.ErrTimeout {
+			t.Fatalf("Expected %v, got %v", nats.ErrTimeout, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Request did not time out")
+	}
+
+	// Reconnect wait.
+	s.DisconnectAll()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("Not disconnected")
+	}
+	if !clock.WaitForTimers(1, time.Second) {
+		t.Fatal("Reconnect timer not set")
+	}
+	select {
+	case <-reconnected:
+		t.Fatal("Reconnected without waiting")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Advance(time.Hour + time.Second)
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("Did not reconnect")
+	}
+}
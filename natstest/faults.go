@@ -0,0 +1,469 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package natstest
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Dialer creates connections, like nats.CustomDialer.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// ErrFaultDrop is returned by the connections closed by a FaultDialer.
+var ErrFaultDrop = errors.New("natstest: connection dropped by fault injection")
+
+// FaultDialer wraps the connections of a dialer to inject network faults. It
+// implements nats.CustomDialer:
+//
+//	fd := natstest.NewFaultDialer(nil)
+//	nc, err := nats.Connect(url, nats.SetCustomDialer(fd))
+//	...
+//	fd.SetLatency(50*time.Millisecond, 10*time.Millisecond)
+//	fd.BlackHole(time.Second)
+//
+// Faults can be changed at any time, and apply to all the connections of
+// the dialer, including the ones already established. Delays are measured
+// with the Clock set with SetClock, the deadlines of the connections with the
+// wall clock.
+type FaultDialer struct {
+	dialer Dialer
+
+	mu        sync.Mutex
+	clock     nats.Clock
+	latency   time.Duration
+	jitter    time.Duration
+	bandwidth int
+	maxWrite  int
+	dropAfter int64
+	holeOn    bool
+	holeTimed bool
+	holeGen   uint64
+	hole      chan struct{}
+	dialErr   error
+	conns     map[*faultConn]struct{}
+	rand      *rand.Rand
+}
+
+// NewFaultDialer returns a FaultDialer wrapping the connections of dialer, or
+// of a net.Dialer if nil. No fault is injected until configured.
+func NewFaultDialer(dialer Dialer) *FaultDialer {
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	return &FaultDialer{
+		dialer:    dialer,
+		dropAfter: -1,
+		conns:     make(map[*faultConn]struct{}),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Dial creates a connection with the wrapped dialer, unless SetDialError was
+// used to make dials fail.
+func (fd *FaultDialer) Dial(network, address string) (net.Conn, error) {
+	fd.mu.Lock()
+	err := fd.dialErr
+	fd.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := fd.dialer.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	fc := &faultConn{Conn: conn, fd: fd, closed: make(chan struct{})}
+	fd.mu.Lock()
+	fd.conns[fc] = struct{}{}
+	fd.mu.Unlock()
+	return fc, nil
+}
+
+// SetClock sets the clock measuring the latency, the bandwidth and the
+// duration of the black holes, the time package if nil. A FakeClock makes
+// the delays only pass when advanced.
+func (fd *FaultDialer) SetClock(clock nats.Clock) {
+	fd.mu.Lock()
+	fd.clock = clock
+	fd.mu.Unlock()
+}
+
+// SetLatency delays every read and write by latency plus a random duration
+// up to jitter.
+func (fd *FaultDialer) SetLatency(latency, jitter time.Duration) {
+	fd.mu.Lock()
+	fd.latency, fd.jitter = latency, jitter
+	fd.mu.Unlock()
+}
+
+// SetBandwidth limits the throughput of the reads and writes of each
+// connection to bytesPerSec. Zero removes the limit.
+func (fd *FaultDialer) SetBandwidth(bytesPerSec int) {
+	fd.mu.Lock()
+	fd.bandwidth = bytesPerSec
+	fd.mu.Unlock()
+}
+
+// SetPartialWrites splits the writes in writes of at most max bytes, each one
+// subject to the latency and bandwidth. Zero removes the limit.
+func (fd *FaultDialer) SetPartialWrites(max int) {
+	fd.mu.Lock()
+	fd.maxWrite = max
+	fd.mu.Unlock()
+}
+
+// DropAfter closes all the connections once n more bytes have been written or
+// read. A write crossing the limit is partially done. A negative n removes
+// the limit.
+func (fd *FaultDialer) DropAfter(n int64) {
+	fd.mu.Lock()
+	fd.dropAfter = n
+	fd.mu.Unlock()
+}
+
+// BlackHole blocks the reads and writes for the duration, as if the network
+// stopped delivering packets. The connections stay open, and the data is
+// delivered once the black hole is lifted. Blocked reads and writes fail
+// when the connection is closed or its deadline is exceeded.
+func (fd *FaultDialer) BlackHole(d time.Duration) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.holeGen++
+	gen := fd.holeGen
+	lift := func() {
+		fd.mu.Lock()
+		if fd.holeGen == gen {
+			fd.holeTimed = false
+			fd.updateHole()
+		}
+		fd.mu.Unlock()
+	}
+	if fd.clock != nil {
+		fd.clock.AfterFunc(d, lift)
+	} else {
+		time.AfterFunc(d, lift)
+	}
+	fd.holeTimed = true
+	fd.updateHole()
+}
+
+// SetBlackHole starts or stops blocking the reads and writes, see BlackHole.
+// Stopping it also lifts the black hole started with BlackHole.
+func (fd *FaultDialer) SetBlackHole(on bool) {
+	fd.mu.Lock()
+	fd.holeOn = on
+	if !on {
+		fd.liftHole()
+	}
+	fd.updateHole()
+	fd.mu.Unlock()
+}
+
+// liftHole cancels the black hole started with BlackHole. Lock should be
+// held.
+func (fd *FaultDialer) liftHole() {
+	fd.holeGen++
+	fd.holeTimed = false
+}
+
+// updateHole creates the channel the blocked reads and writes wait on, or
+// closes it when the black hole is lifted. Lock should be held.
+func (fd *FaultDialer) updateHole() {
+	on := fd.holeOn || fd.holeTimed
+	if on && fd.hole == nil {
+		fd.hole = make(chan struct{})
+	} else if !on && fd.hole != nil {
+		close(fd.hole)
+		fd.hole = nil
+	}
+}
+
+// blackHole returns the channel closed when the black hole is lifted, nil if
+// there is none.
+func (fd *FaultDialer) blackHole() chan struct{} {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return fd.hole
+}
+
+// sleep waits for the duration, measured with the clock, or for the done
+// channel to be closed.
+func (fd *FaultDialer) sleep(d time.Duration, done chan struct{}) {
+	fd.mu.Lock()
+	clock := fd.clock
+	fd.mu.Unlock()
+	var expired <-chan time.Time
+	if clock != nil {
+		t := clock.NewTimer(d)
+		defer t.Stop()
+		expired = t.C()
+	} else {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case <-expired:
+	case <-done:
+	}
+}
+
+// SetDialError makes the dials fail with err. A nil err lets them succeed.
+func (fd *FaultDialer) SetDialError(err error) {
+	fd.mu.Lock()
+	fd.dialErr = err
+	fd.mu.Unlock()
+}
+
+// CloseAll abruptly closes all the connections.
+func (fd *FaultDialer) CloseAll() {
+	for _, fc := range fd.allConns() {
+		fc.drop()
+	}
+}
+
+// Reset removes all the faults. Connections are not affected.
+func (fd *FaultDialer) Reset() {
+	fd.mu.Lock()
+	fd.latency, fd.jitter = 0, 0
+	fd.bandwidth, fd.maxWrite = 0, 0
+	fd.dropAfter = -1
+	fd.holeOn = false
+	fd.liftHole()
+	fd.updateHole()
+	fd.dialErr = nil
+	fd.mu.Unlock()
+}
+
+// NumConns returns the number of open connections.
+func (fd *FaultDialer) NumConns() int {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return len(fd.conns)
+}
+
+func (fd *FaultDialer) allConns() []*faultConn {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	conns := make([]*faultConn, 0, len(fd.conns))
+	for fc := range fd.conns {
+		conns = append(conns, fc)
+	}
+	return conns
+}
+
+// faults are the faults applying to a transfer of n bytes.
+type faults struct {
+	delay time.Duration
+	n     int
+	drop  bool
+}
+
+// take returns the faults for a transfer of up to n bytes, and accounts for
+// the bytes against the DropAfter limit.
+func (fd *FaultDialer) take(n int, write bool) faults {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	f := faults{n: n}
+	if write && fd.maxWrite > 0 && f.n > fd.maxWrite {
+		f.n = fd.maxWrite
+	}
+	if fd.dropAfter >= 0 {
+		if int64(f.n) >= fd.dropAfter {
+			f.n = int(fd.dropAfter)
+			f.drop = true
+			fd.dropAfter = -1
+		} else {
+			fd.dropAfter -= int64(f.n)
+		}
+	}
+	f.delay = fd.latency
+	if fd.jitter > 0 {
+		f.delay += time.Duration(fd.rand.Int63n(int64(fd.jitter)))
+	}
+	if fd.bandwidth > 0 {
+		f.delay += time.Duration(f.n) * time.Second / time.Duration(fd.bandwidth)
+	}
+	return f
+}
+
+// faultConn is a connection created by a FaultDialer.
+type faultConn struct {
+	net.Conn
+	fd     *FaultDialer
+	closed chan struct{}
+
+	mu            sync.Mutex
+	dropped       bool
+	closing       bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// Data read while in a black hole, and the error of the read. Only
+	// used by Read.
+	unread  []byte
+	readErr error
+}
+
+func (fc *faultConn) isDropped() bool {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.dropped
+}
+
+// drop closes the connection on behalf of the dialer.
+func (fc *faultConn) drop() {
+	fc.mu.Lock()
+	fc.dropped = true
+	fc.mu.Unlock()
+	fc.Close()
+}
+
+// waitHole waits for the black hole, if any, to be lifted. It fails if the
+// connection is closed or the deadline is exceeded first.
+func (fc *faultConn) waitHole(deadline time.Time) error {
+	hole := fc.fd.blackHole()
+	if hole == nil {
+		return nil
+	}
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		expired = t.C
+	}
+	select {
+	case <-hole:
+		return nil
+	case <-fc.closed:
+		if fc.isDropped() {
+			return ErrFaultDrop
+		}
+		return net.ErrClosed
+	case <-expired:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+func (fc *faultConn) deadlines() (read, write time.Time) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.readDeadline, fc.writeDeadline
+}
+
+func (fc *faultConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		if fc.isDropped() {
+			return written, ErrFaultDrop
+		}
+		_, deadline := fc.deadlines()
+		if err := fc.waitHole(deadline); err != nil {
+			return written, err
+		}
+		f := fc.fd.take(len(b)-written, true)
+		if f.delay > 0 {
+			fc.fd.sleep(f.delay, fc.closed)
+		}
+		if f.n > 0 {
+			n, err := fc.Conn.Write(b[written : written+f.n])
+			written += n
+			if err != nil {
+				return written, err
+			}
+		}
+		if f.drop {
+			fc.fd.CloseAll()
+			return written, ErrFaultDrop
+		}
+	}
+	return written, nil
+}
+
+func (fc *faultConn) Read(b []byte) (int, error) {
+	if len(fc.unread) == 0 {
+		n, err := fc.Conn.Read(b)
+		if fc.isDropped() {
+			return 0, ErrFaultDrop
+		}
+		if n == 0 {
+			return n, err
+		}
+		// Keep the data until it can be delivered.
+		fc.unread = append(fc.unread[:0], b[:n]...)
+		fc.readErr = err
+	}
+	deadline, _ := fc.deadlines()
+	if err := fc.waitHole(deadline); err != nil {
+		return 0, err
+	}
+	f := fc.fd.take(len(fc.unread), false)
+	if f.delay > 0 {
+		fc.fd.sleep(f.delay, fc.closed)
+	}
+	n := copy(b, fc.unread[:f.n])
+	fc.unread = fc.unread[n:]
+	if f.drop {
+		fc.fd.CloseAll()
+		return n, ErrFaultDrop
+	}
+	if len(fc.unread) > 0 {
+		return n, nil
+	}
+	err := fc.readErr
+	fc.readErr = nil
+	return n, err
+}
+
+func (fc *faultConn) SetDeadline(t time.Time) error {
+	fc.mu.Lock()
+	fc.readDeadline, fc.writeDeadline = t, t
+	fc.mu.Unlock()
+	return fc.Conn.SetDeadline(t)
+}
+
+func (fc *faultConn) SetReadDeadline(t time.Time) error {
+	fc.mu.Lock()
+	fc.readDeadline = t
+	fc.mu.Unlock()
+	return fc.Conn.SetReadDeadline(t)
+}
+
+func (fc *faultConn) SetWriteDeadline(t time.Time) error {
+	fc.mu.Lock()
+	fc.writeDeadline = t
+	fc.mu.Unlock()
+	return fc.Conn.SetWriteDeadline(t)
+}
+
+func (fc *faultConn) Close() error {
+	fc.fd.mu.Lock()
+	delete(fc.fd.conns, fc)
+	fc.fd.mu.Unlock()
+	fc.mu.Lock()
+	if !fc.closing {
+		fc.closing = true
+		close(fc.closed)
+	}
+	fc.mu.Unlock()
+	return fc.Conn.Close()
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package natstest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/natstest"
+)
+
+func connectFaulty(t *testing.T, fd *natstest.FaultDialer, url string, opts ...nats.Option) (*nats.Conn, chan error, chan struct{}) {
+	t.Helper()
+	disconnected := make(chan error, 10)
+	reconnected := make(chan struct{}, 10)
+	opts = append([]nats.Option{
+		nats.SetCustomDialer(fd),
+		nats.ReconnectWait(10 * time.Millisecond),
+		nats.ReconnectJitter(0, 0),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) { disconnected <- err }),
+		nats.ReconnectHandler(func(*nats.Conn) { reconnected <- struct{}{} }),
+	}, opts...)
+	nc, err := nats.Connect(url, opts...)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	return nc, disconnected, reconnected
+}
+
+func waitChan(t *testing.T, ch chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timeout waiting for %s", what)
+	}
+}
+
+func TestFaultDialerLatency(t *testing.T) {
+	s := natstest.NewServer()
+	defer s.Shutdown()
+	fd := natstest.NewFaultDialer(s)
+
+	nc, _, _ := connectFaulty(t, fd, s.ClientURL())
+	defer nc.Close()
+
+	fd.SetLatency(50*time.Millisecond, 0)
+	start := time.Now()
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error flushing: %v", err)
+	}
+	// One write of the PING and one read of the PONG.
+	if rtt := time.Since(start); rtt < 100*time.Millisecond {
+		t.Fatalf("Expected the latency to apply, got a round trip of %v", rtt)
+	}
+
+	fd.Reset()
+	fd.SetBandwidth(10000)
+	fd.SetPartialWrites(100)
+	start = time.Now()
+	if err := nc.Publish("foo", make([]byte, 1000)); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error flushing: %v", err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("Expected the bandwidth to be limited, took %v", d)
+	}
+	if op, err := s.WaitFor(natstest.OpPub, "foo", time.Second); err != nil || len(op.Data) != 1000 {
+		t.Fatalf("Unexpected PUB: %v %v", op, err)
+	}
+}
+
+func TestFaultDialerClock(t *testing.T) {
+	s := natstest.NewServer()
+	defer s.Shutdown()
+	fd := natstest.NewFaultDialer(s)
+
+	nc, _, _ := connectFaulty(t, fd, s.ClientURL())
+	defer nc.Close()
+
+	clock := natstest.NewFakeClock(time.Now())
+	fd.SetClock(clock)
+	fd.SetLatency(time.Hour, 0)
+	errCh := make(chan error, 1)
+	go func() { errCh <- nc.FlushTimeout(5 * time.Second) }()
+	// One write of the PING and one read of the PONG.
+	for i := 0; i < 2; i++ {
+		if !clock.WaitForTimers(1, time.Second) {
+			t.Fatal("Latency timer not set")
+		}
+		clock.Advance(time.Hour)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Error flushing: %v", err)
+	}
+}
+
+func TestFaultDialerBlackHole(t *testing.T) {
+	s := natstest.NewServer()
+	defer s.Shutdown()
+	fd := natstest.NewFaultDialer(s)
+
+	nc, disconnected, reconnected := connectFaulty(t, fd, s.ClientURL(),
+		nats.PingInterval(20*time.Millisecond),
+		nats.MaxPingsOutstanding(2),
+		nats.FlusherTimeout(10*time.Millisecond))
+	defer nc.Close()
+
+	// Data is delivered once the black hole is lifted.
+	sub, err := nc.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+	nc.Flush()
+	clock := natstest.NewFakeClock(time.Now())
+	fd.SetClock(clock)
+	fd.BlackHole(time.Minute)
+	pub, err := nats.Connect(s.ClientURL(), nats.SetCustomDialer(s))
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer pub.Close()
+	pub.Publish("foo", []byte("held"))
+	pub.Flush()
+	if _, err := sub.NextMsg(50 * time.Millisecond); err != nats.ErrTimeout {
+		t.Fatalf("Expected the message to be held, got %v", err)
+	}
+	clock.Advance(time.Minute)
+	if m, err := sub.NextMsg(time.Second); err != nil || string(m.Data) != "held" {
+		t.Fatalf("Unexpected message: %v %v", m, err)
+	}
+	fd.SetClock(nil)
+
+	// PINGs are held, so the connection is detected as stale.
+	fd.BlackHole(time.Hour)
+	select {
+	case err := <-disconnected:
+		if err != nats.ErrStaleConnection {
+			t.Fatalf("Expected %v, got %v", nats.ErrStaleConnection, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stale connection not detected")
+	}
+	fd.SetBlackHole(false)
+	waitChan(t, reconnected, "reconnect")
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error flushing: %v", err)
+	}
+}
+
+func TestFaultDialerDrops(t *testing.T) {
+	s := natstest.NewServer()
+	defer s.Shutdown()
+	fd := natstest.NewFaultDialer(s)
+
+	nc, disconnected, reconnected := connectFaulty(t, fd, s.ClientURL())
+	defer nc.Close()
+
+	// The connection is dropped in the middle of a message.
+	fd.DropAfter(10)
+	nc.Publish("foo", make([]byte, 100))
+	nc.Flush()
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Connection not dropped")
+	}
+	waitChan(t, reconnected, "reconnect")
+
+	// While the server cannot be reached, messages are buffered.
+	fd.SetDialError(errors.New("connection refused"))
+	fd.CloseAll()
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Connection not closed")
+	}
+	if err := nc.Publish("bar", []byte("buffered")); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !nc.IsReconnecting() || fd.NumConns() != 0 {
+		t.Fatalf("Expected to be reconnecting without connection, got %v %d", nc.Status(), fd.NumConns())
+	}
+	fd.SetDialError(nil)
+	waitChan(t, reconnected, "reconnect")
+	if op, err := s.WaitFor(natstest.OpPub, "bar", time.Second); err != nil || string(op.Data) != "buffered" {
+		t.Fatalf("Unexpected PUB: %v %v", op, err)
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package natstest_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/natstest"
+)
+
+func TestServerPubSub(t *testing.T) {
+	s := natstest.NewServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL(), nats.InProcessServer(s))
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo.*")
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+	all, err := nc.SubscribeSync("foo.>")
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+	if err := nc.Publish("foo.bar", []byte("hello")); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+	m := nats.NewMsg("foo.bar.baz")
+	m.Header.Set("X-Test", "1")
+	m.Data = []byte("world")
+	if err := nc.PublishMsg(m); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+
+	msg, err := sub.NextMsg(time.Second)
+	if err != nil || string(msg.Data) != "hello" {
+		t.Fatalf("Unexpected message: %v %v", msg, err)
+	}
+	if msg, err := sub.NextMsg(100 * time.Millisecond); err == nil {
+		t.Fatalf("Unexpected message: %q", msg.Subject)
+	}
+	for _, data := range []string{"hello", "world"} {
+		msg, err := all.NextMsg(time.Second)
+		if err != nil || string(msg.Data) != data {
+			t.Fatalf("Unexpected message: %v %v", msg, err)
+		}
+		if data == "world" && msg.Header.Get("X-Test") != "1" {
+			t.Fatalf("Unexpected header: %v", msg.Header)
+		}
+	}
+
+	op, err := s.WaitFor(natstest.OpHPub, "foo.bar.baz", time.Second)
+	if err != nil {
+		t.Fatalf("Error waiting for HPUB: %v", err)
+	}
+	if string(op.Data) != "world" || !strings.Contains(string(op.Header), "X-Test: 1") {
+		t.Fatalf("Unexpected HPUB: %q %q", op.Header, op.Data)
+	}
+	if op, err := s.WaitFor(natstest.OpConnect, "", time.Second); err != nil || !strings.Contains(string(op.Data), `"headers":true`) {
+		t.Fatalf("Unexpected CONNECT: %v %v", op, err)
+	}
+}
+
+func TestServerRequestAndQueues(t *testing.T) {
+	s := natstest.NewServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL(), nats.SetCustomDialer(s))
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer nc.Close()
+
+	count := make(chan struct{}, 10)
+	for i := 0; i < 2; i++ {
+		_, err := nc.QueueSubscribe("svc", "q", func(m *nats.Msg) {
+			count <- struct{}{}
+			m.Respond([]byte("ok"))
+		})
+		if err != nil {
+			t.Fatalf("Error subscribing: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		resp, err := nc.Request("svc", nil, time.Second)
+		if err != nil || string(resp.Data) != "ok" {
+			t.Fatalf("Unexpected response: %v %v", resp, err)
+		}
+	}
+	if len(count) != 3 {
+		t.Fatalf("Expected 3 deliveries to the queue group, got %d", len(count))
+	}
+
+	// The same queue name on another subject is another group.
+	other, err := nc.QueueSubscribeSync("svc.*", "q")
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+	exact, err := nc.QueueSubscribeSync("svc.a", "q")
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+	nc.Publish("svc.a", nil)
+	for _, sub := range []*nats.Subscription{other, exact} {
+		if _, err := sub.NextMsg(time.Second); err != nil {
+			t.Fatalf("Error receiving on %q: %v", sub.Subject, err)
+		}
+	}
+
+	// Auto unsubscribe is honored by the server.
+	sub, err := nc.SubscribeSync("bar")
+	if err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+	sub.AutoUnsubscribe(1)
+	nc.Publish("bar", nil)
+	nc.Publish("bar", nil)
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error flushing: %v", err)
+	}
+	if _, err := s.WaitFor(natstest.OpUnsub, "", time.Second); err != nil {
+		t.Fatalf("Error waiting for UNSUB: %v", err)
+	}
+	if _, err := sub.NextMsg(time.Second); err != nil {
+		t.Fatalf("Error receiving: %v", err)
+	}
+
+	// Only the most recent operations are kept.
+	s.SetMaxRecorded(2)
+	for i := 0; i < 5; i++ {
+		nc.Publish("baz", []byte{byte(i)})
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error flushing: %v", err)
+	}
+	ops := s.Received()
+	if len(ops) != 2 || ops[0].Kind != natstest.OpPub || ops[0].Data[0] != 4 || ops[1].Kind != natstest.OpPing {
+		t.Fatalf("Unexpected operations: %+v", ops)
+	}
+	s.SetMaxRecorded(-1)
+	nc.Publish("baz", nil)
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("Error flushing: %v", err)
+	}
+	if ops := s.Received(); len(ops) != 0 {
+		t.Fatalf("Unexpected operations: %+v", ops)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s := natstest.NewServer()
+	defer s.Shutdown()
+
+	errCh := make(chan error, 10)
+	reconnected := make(chan struct{}, 10)
+	lameDuck := make(chan struct{}, 10)
+	nc, err := nats.Connect(s.ClientURL(),
+		nats.InProcessServer(s),
+		nats.ReconnectWait(10*time.Millisecond),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) { errCh <- err }),
+		nats.ReconnectHandler(func(*nats.Conn) { reconnected <- struct{}{} }),
+		nats.LameDuckModeHandler(func(*nats.Conn) { lameDuck <- struct{}{} }),
+	)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer nc.Close()
+
+	// Errors returned by the hook are sent to the client.
+	s.SetHook(func(op *natstest.ClientOp) error {
+		if op.Kind == natstest.OpSub && op.Subject == "denied" {
+			return errors.New("Permissions Violation for Subscription to \"denied\"")
+		}
+		return nil
+	})
+	if _, err := nc.SubscribeSync("denied"); err != nil {
+		t.Fatalf("Error subscribing: %v", err)
+	}
+	select {
+	case err := <-errCh:
+		if !strings.Contains(err.Error(), "Permissions Violation") {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Did not get the permissions violation")
+	}
+
+	s.LameDuck()
+	select {
+	case <-lameDuck:
+	case <-time.After(time.Second):
+		t.Fatal("Did not get the lame duck mode notification")
+	}
+
+	s.DisconnectAll()
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Did not reconnect")
+	}
+	if n := s.NumClients(); n != 1 {
+		t.Fatalf("Expected 1 client, got %d", n)
+	}
+
+	// The denied subscription is sent again on reconnect.
+	s.SendError("Authorization Violation")
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case err := <-errCh:
+			if err == nats.ErrAuthorization {
+				return
+			}
+			if !strings.Contains(err.Error(), "Permissions Violation") {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		case <-timeout:
+			t.Fatal("Did not get the authorization error")
+		}
+	}
+}
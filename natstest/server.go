@@ -0,0 +1,592 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package natstest provides an in-process server implementing the core NATS
+// client protocol, for unit tests that do not need a full NATS server.
+//
+// The server is used through the nats.InProcessServer() or
+// nats.SetCustomDialer() options:
+//
+//	s := natstest.NewServer()
+//	defer s.Shutdown()
+//	nc, err := nats.Connect(s.ClientURL(), nats.InProcessServer(s))
+//
+// It routes messages between its clients, with wildcards and queue groups,
+// and records what the clients sent. There is no JetStream, clustering,
+// authentication or TLS support.
+//
+// The package also provides a FaultDialer to inject network faults in the
+// connections, and a FakeClock to control the passing of time.
+package natstest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of the operations sent by the clients.
+const (
+	OpConnect = "CONNECT"
+	OpPub     = "PUB"
+	OpHPub    = "HPUB"
+	OpSub     = "SUB"
+	OpUnsub   = "UNSUB"
+	OpPing    = "PING"
+	OpPong    = "PONG"
+)
+
+// Info is the information the server sends to its clients.
+type Info struct {
+	ID          string   `json:"server_id"`
+	Name        string   `json:"server_name"`
+	Proto       int      `json:"proto"`
+	Version     string   `json:"version"`
+	Host        string   `json:"host"`
+	Port        int      `json:"port"`
+	Headers     bool     `json:"headers"`
+	MaxPayload  int64    `json:"max_payload"`
+	CID         uint64   `json:"client_id,omitempty"`
+	ConnectURLs []string `json:"connect_urls,omitempty"`
+	LameDuck    bool     `json:"ldm,omitempty"`
+}
+
+// ClientOp is an operation sent by a client to the server.
+type ClientOp struct {
+	// Client is the id of the client, as sent in its INFO.
+	Client uint64
+	// Kind is the protocol operation, one of the Op constants.
+	Kind    string
+	Subject string
+	Reply   string
+	Queue   string
+	Sid     string
+	// Max is the number of messages after which an UNSUB is effective.
+	Max int
+	// Header is the raw header of an HPUB.
+	Header []byte
+	// Data is the payload of a PUB or HPUB, or the JSON of a CONNECT.
+	Data []byte
+}
+
+// DefaultMaxRecorded is the default maximum number of operations recorded
+// by a server, see SetMaxRecorded.
+const DefaultMaxRecorded = 10000
+
+// Hook is called for each operation sent by a client, before the server
+// processes it. A non nil error is sent to the client as -ERR and the
+// operation is not processed.
+type Hook func(op *ClientOp) error
+
+// Server is an in-process server implementing the core client protocol.
+type Server struct {
+	mu       sync.Mutex
+	info     Info
+	clients  map[uint64]*client
+	nextCID  uint64
+	ops      []*ClientOp
+	maxOps   int
+	opsCond  *sync.Cond
+	waited   map[*ClientOp]struct{}
+	hook     Hook
+	shutdown bool
+}
+
+type client struct {
+	srv  *Server
+	cid  uint64
+	conn net.Conn
+	// Pending outbound data, written by a separate goroutine since writes
+	// to a net.Pipe block until the client reads them.
+	wmu    sync.Mutex
+	wcond  *sync.Cond
+	out    []byte
+	closed bool
+	// Subscriptions by sid, protected by the server lock.
+	subs map[string]*subscription
+}
+
+type subscription struct {
+	c         *client
+	subject   string
+	queue     string
+	sid       string
+	max       int
+	delivered int
+}
+
+// NewServer returns a server ready to accept in-process connections.
+func NewServer() *Server {
+	s := &Server{
+		info: Info{
+			ID:         "NATSTEST",
+			Name:       "natstest",
+			Proto:      1,
+			Version:    "2.9.0",
+			Host:       "natstest",
+			Port:       4222,
+			Headers:    true,
+			MaxPayload: 1024 * 1024,
+		},
+		clients: make(map[uint64]*client),
+		maxOps:  DefaultMaxRecorded,
+		waited:  make(map[*ClientOp]struct{}),
+	}
+	s.opsCond = sync.NewCond(&s.mu)
+	return s
+}
+
+// ClientURL returns the URL clients can use to connect, through
+// nats.InProcessServer() or nats.SetCustomDialer().
+func (s *Server) ClientURL() string {
+	return fmt.Sprintf("nats://%s:%d", s.info.Host, s.info.Port)
+}
+
+// SetHook sets the hook called for each operation sent by the clients.
+func (s *Server) SetHook(hook Hook) {
+	s.mu.Lock()
+	s.hook = hook
+	s.mu.Unlock()
+}
+
+// SetMaxRecorded sets the maximum number of operations kept for Received
+// and WaitFor, the oldest ones are dropped beyond it. Zero keeps all of them,
+// and a negative value disables the recording.
+func (s *Server) SetMaxRecorded(max int) {
+	s.mu.Lock()
+	s.maxOps = max
+	s.trimOps()
+	s.mu.Unlock()
+}
+
+// InProcessConn returns a new connection to the server, implementing
+// nats.InProcessConnProvider.
+func (s *Server) InProcessConn() (net.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		return nil, errors.New("natstest: server is shut down")
+	}
+	cconn, sconn := net.Pipe()
+	s.nextCID++
+	c := &client{srv: s, cid: s.nextCID, conn: sconn, subs: make(map[string]*subscription)}
+	c.wcond = sync.NewCond(&c.wmu)
+	s.clients[c.cid] = c
+	info := s.info
+	info.CID = c.cid
+	go c.writeLoop()
+	go c.run(info)
+	return cconn, nil
+}
+
+// Dial returns a new connection to the server, implementing nats.CustomDialer.
+// The address is ignored.
+func (s *Server) Dial(network, address string) (net.Conn, error) {
+	return s.InProcessConn()
+}
+
+// NumClients returns the number of connected clients.
+func (s *Server) NumClients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// Received returns the operations sent by the clients so far, up to the
+// maximum set with SetMaxRecorded.
+func (s *Server) Received() []*ClientOp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*ClientOp(nil), s.ops...)
+}
+
+// WaitFor waits for a client to send an operation of this kind, and for
+// this subject unless empty, that was not returned by a previous WaitFor.
+func (s *Server) WaitFor(kind, subject string, timeout time.Duration) (*ClientOp, error) {
+	timer := time.AfterFunc(timeout, func() {
+		s.mu.Lock()
+		s.opsCond.Broadcast()
+		s.mu.Unlock()
+	})
+	defer timer.Stop()
+	deadline := time.Now().Add(timeout)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		for _, op := range s.ops {
+			if _, ok := s.waited[op]; ok || op.Kind != kind || (subject != "" && op.Subject != subject) {
+				continue
+			}
+			s.waited[op] = struct{}{}
+			return op, nil
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("natstest: timeout waiting for %s %s", kind, subject)
+		}
+		s.opsCond.Wait()
+	}
+}
+
+// SendError sends an -ERR to all the clients.
+func (s *Server) SendError(msg string) {
+	for _, c := range s.allClients() {
+		c.sendErr(msg)
+	}
+}
+
+// DisconnectAll closes the connections of all the clients.
+func (s *Server) DisconnectAll() {
+	for _, c := range s.allClients() {
+		c.close()
+	}
+}
+
+// UpdateInfo modifies the information of the server, and sends it to all the
+// clients.
+func (s *Server) UpdateInfo(update func(info *Info)) {
+	s.mu.Lock()
+	update(&s.info)
+	info := s.info
+	s.mu.Unlock()
+	for _, c := range s.allClients() {
+		info.CID = c.cid
+		c.sendInfo(info)
+	}
+}
+
+// LameDuck sends an INFO to all the clients telling that the server is in
+// lame duck mode.
+func (s *Server) LameDuck() {
+	s.UpdateInfo(func(info *Info) { info.LameDuck = true })
+}
+
+// Shutdown disconnects the clients and rejects new connections.
+func (s *Server) Shutdown() {
+	s.mu.Lock()
+	s.shutdown = true
+	s.mu.Unlock()
+	s.DisconnectAll()
+}
+
+func (s *Server) allClients() []*client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients := make([]*client, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// record stores the operation and calls the hook.
+func (s *Server) record(op *ClientOp) error {
+	s.mu.Lock()
+	if s.maxOps >= 0 {
+		s.ops = append(s.ops, op)
+		s.trimOps()
+		s.opsCond.Broadcast()
+	}
+	hook := s.hook
+	s.mu.Unlock()
+	if hook != nil {
+		return hook(op)
+	}
+	return nil
+}
+
+// trimOps drops the oldest operations beyond the maximum. Lock should be held.
+func (s *Server) trimOps() {
+	n := len(s.ops) - s.maxOps
+	if s.maxOps < 0 {
+		n = len(s.ops)
+	}
+	if s.maxOps == 0 || n <= 0 {
+		return
+	}
+	for _, op := range s.ops[:n] {
+		delete(s.waited, op)
+	}
+	s.ops = append(s.ops[:0:0], s.ops[n:]...)
+}
+
+// write queues the data to be sent to the client.
+func (c *client) write(b []byte) {
+	c.wmu.Lock()
+	if !c.closed {
+		c.out = append(c.out, b...)
+		c.wcond.Signal()
+	}
+	c.wmu.Unlock()
+}
+
+// writeLoop sends the queued data until the client is closed.
+func (c *client) writeLoop() {
+	c.wmu.Lock()
+	for {
+		for len(c.out) == 0 && !c.closed {
+			c.wcond.Wait()
+		}
+		if c.closed {
+			c.wmu.Unlock()
+			return
+		}
+		b := c.out
+		c.out = nil
+		c.wmu.Unlock()
+		if _, err := c.conn.Write(b); err != nil {
+			c.close()
+		}
+		c.wmu.Lock()
+	}
+}
+
+// close closes the connection of the client.
+func (c *client) close() {
+	c.wmu.Lock()
+	c.closed = true
+	c.wcond.Signal()
+	c.wmu.Unlock()
+	c.conn.Close()
+}
+
+func (c *client) sendInfo(info Info) {
+	b, _ := json.Marshal(info)
+	c.write([]byte(fmt.Sprintf("INFO %s\r\n", b)))
+}
+
+func (c *client) sendErr(msg string) {
+	c.write([]byte(fmt.Sprintf("-ERR '%s'\r\n", msg)))
+}
+
+// run serves the client until its connection is closed.
+func (c *client) run(info Info) {
+	defer func() {
+		c.close()
+		s := c.srv
+		s.mu.Lock()
+		delete(s.clients, c.cid)
+		s.mu.Unlock()
+	}()
+	c.sendInfo(info)
+
+	r := bufio.NewReader(c.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		verb, args := line, []string(nil)
+		if i := strings.IndexAny(line, " \t"); i > 0 {
+			verb, args = line[:i], strings.Fields(line[i:])
+		}
+		op := &ClientOp{Client: c.cid, Kind: strings.ToUpper(verb)}
+		if err := c.parse(op, args, r); err != nil {
+			if err != io.EOF {
+				c.sendErr(err.Error())
+			}
+			return
+		}
+		if err := c.srv.record(op); err != nil {
+			c.sendErr(err.Error())
+			continue
+		}
+		c.process(op)
+	}
+}
+
+// parse reads the arguments and the payload of the operation.
+func (c *client) parse(op *ClientOp, args []string, r *bufio.Reader) error {
+	readPayload := func(size string) ([]byte, error) {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 0 {
+			return nil, errors.New("Invalid Payload Size")
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+	var err error
+	switch op.Kind {
+	case OpConnect:
+		op.Data = []byte(strings.Join(args, " "))
+	case OpPing, OpPong:
+	case OpPub:
+		switch len(args) {
+		case 2:
+			op.Subject = args[0]
+		case 3:
+			op.Subject, op.Reply = args[0], args[1]
+		default:
+			return errors.New("Invalid Publish Arguments")
+		}
+		op.Data, err = readPayload(args[len(args)-1])
+	case OpHPub:
+		switch len(args) {
+		case 3:
+			op.Subject = args[0]
+		case 4:
+			op.Subject, op.Reply = args[0], args[1]
+		default:
+			return errors.New("Invalid Publish Arguments")
+		}
+		hdr, herr := strconv.Atoi(args[len(args)-2])
+		if herr != nil {
+			return errors.New("Invalid Header Size")
+		}
+		var b []byte
+		if b, err = readPayload(args[len(args)-1]); err == nil {
+			if hdr > len(b) {
+				return errors.New("Invalid Header Size")
+			}
+			op.Header, op.Data = b[:hdr], b[hdr:]
+		}
+	case OpSub:
+		switch len(args) {
+		case 2:
+			op.Subject, op.Sid = args[0], args[1]
+		case 3:
+			op.Subject, op.Queue, op.Sid = args[0], args[1], args[2]
+		default:
+			return errors.New("Invalid Subscription Arguments")
+		}
+	case OpUnsub:
+		switch len(args) {
+		case 1:
+			op.Sid = args[0]
+		case 2:
+			op.Sid = args[0]
+			if op.Max, err = strconv.Atoi(args[1]); err != nil {
+				return errors.New("Invalid Unsubscribe Arguments")
+			}
+		default:
+			return errors.New("Invalid Unsubscribe Arguments")
+		}
+	default:
+		return errors.New("Unknown Protocol Operation")
+	}
+	return err
+}
+
+// process applies the operation.
+func (c *client) process(op *ClientOp) {
+	s := c.srv
+	switch op.Kind {
+	case OpConnect:
+		var opts struct {
+			Verbose bool `json:"verbose"`
+		}
+		json.Unmarshal(op.Data, &opts)
+		if opts.Verbose {
+			c.write([]byte("+OK\r\n"))
+		}
+	case OpPing:
+		c.write([]byte("PONG\r\n"))
+	case OpSub:
+		s.mu.Lock()
+		c.subs[op.Sid] = &subscription{c: c, subject: op.Subject, queue: op.Queue, sid: op.Sid}
+		s.mu.Unlock()
+	case OpUnsub:
+		s.mu.Lock()
+		if sub, ok := c.subs[op.Sid]; ok {
+			if op.Max > 0 && sub.delivered < op.Max {
+				sub.max = op.Max
+			} else {
+				delete(c.subs, op.Sid)
+			}
+		}
+		s.mu.Unlock()
+	case OpPub, OpHPub:
+		s.deliver(op)
+	}
+}
+
+// queueGroup identifies a queue group, subscriptions with the same queue
+// name on different subjects are in different groups.
+type queueGroup struct {
+	subject, queue string
+}
+
+// deliver sends the message to the matching subscriptions, and to one
+// member of each queue group.
+func (s *Server) deliver(op *ClientOp) {
+	s.mu.Lock()
+	var targets []*subscription
+	queues := make(map[queueGroup]bool)
+	for _, c := range s.clients {
+		for _, sub := range c.subs {
+			if !subjectMatches(sub.subject, op.Subject) {
+				continue
+			}
+			if sub.queue != "" {
+				qg := queueGroup{sub.subject, sub.queue}
+				if queues[qg] {
+					continue
+				}
+				queues[qg] = true
+			}
+			sub.delivered++
+			if sub.max > 0 && sub.delivered >= sub.max {
+				delete(c.subs, sub.sid)
+			}
+			targets = append(targets, sub)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sub := range targets {
+		var b bytes.Buffer
+		reply := ""
+		if op.Reply != "" {
+			reply = op.Reply + " "
+		}
+		if op.Kind == OpHPub {
+			fmt.Fprintf(&b, "HMSG %s %s %s%d %d\r\n", op.Subject, sub.sid, reply, len(op.Header), len(op.Header)+len(op.Data))
+			b.Write(op.Header)
+		} else {
+			fmt.Fprintf(&b, "MSG %s %s %s%d\r\n", op.Subject, sub.sid, reply, len(op.Data))
+		}
+		b.Write(op.Data)
+		b.WriteString("\r\n")
+		sub.c.write(b.Bytes())
+	}
+}
+
+// subjectMatches returns true if the subject matches the filter, which can
+// have wildcards.
+func subjectMatches(filter, subject string) bool {
+	ft, st := strings.Split(filter, "."), strings.Split(subject, ".")
+	for i, t := range ft {
+		if t == ">" {
+			return len(st) > i
+		}
+		if i >= len(st) || (t != "*" && t != st[i]) {
+			return false
+		}
+	}
+	return len(ft) == len(st)
+}
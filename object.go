@@ -17,14 +17,18 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
+	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -44,6 +48,10 @@ type ObjectStoreManager interface {
 	CreateObjectStore(cfg *ObjectStoreConfig) (ObjectStore, error)
 	// DeleteObjectStore will delete the underlying stream for the named object.
 	DeleteObjectStore(bucket string) error
+	// ObjectStoreNames is used to retrieve a list of object store names.
+	ObjectStoreNames(opts ...JSOpt) <-chan string
+	// ObjectStores is used to retrieve the status of all object stores.
+	ObjectStores(opts ...JSOpt) <-chan ObjectStoreStatus
 }
 
 // ObjectStore is a blob store capable of storing large objects efficiently in
@@ -55,6 +63,9 @@ type ObjectStoreManager interface {
 type ObjectStore interface {
 	// Put will place the contents from the reader into a new object.
 	Put(obj *ObjectMeta, reader io.Reader, opts ...ObjectOpt) (*ObjectInfo, error)
+	// PutWriter returns a writer placing the data written into a new object.
+	// The object is created when the writer is closed.
+	PutWriter(meta *ObjectMeta, opts ...ObjectOpt) (ObjectWriter, error)
 	// Get will pull the named object from the object store.
 	Get(name string, opts ...ObjectOpt) (ObjectResult, error)
 
@@ -81,6 +92,15 @@ type ObjectStore interface {
 	// Delete will delete the named object.
 	Delete(name string) error
 
+	// Versions returns the versions of the named object retained by a
+	// versioned bucket, oldest first. The last one is the current version.
+	Versions(name string) ([]*ObjectInfo, error)
+	// GetVersion will pull the version of the named object with this NUID.
+	GetVersion(name, nuid string, opts ...ObjectOpt) (ObjectResult, error)
+	// RestoreVersion makes the version of the named object with this NUID the
+	// current version.
+	RestoreVersion(name, nuid string) (*ObjectInfo, error)
+
 	// AddLink will add a link to another object.
 	AddLink(name string, obj *ObjectInfo) (*ObjectInfo, error)
 
@@ -92,12 +112,37 @@ type ObjectStore interface {
 
 	// Watch for changes in the underlying store and receive meta information updates.
 	Watch(opts ...WatchOpt) (ObjectWatcher, error)
+	// WatchEvents watches the changes of the objects, and reports their kind.
+	WatchEvents(opts ...WatchOpt) (ObjectEventWatcher, error)
 
 	// List will list all the objects in this store.
 	List(opts ...WatchOpt) ([]*ObjectInfo, error)
 
+	// ListObjects lists a page of the objects in this store, in name order.
+	// Only the meta information of the objects in the page is retrieved.
+	ListObjects(opts ...ListObjectsOpt) (*ObjectListing, error)
+
 	// Status retrieves run-time status about the backing store of the bucket.
 	Status() (ObjectStoreStatus, error)
+
+	// Reap deletes the expired objects, and the objects that are beyond the
+	// retention rules. It returns the objects deleted.
+	Reap(rules ...*ObjectRetentionRule) ([]*ObjectInfo, error)
+	// StartReaper runs Reap at the interval until the reaper is stopped.
+	StartReaper(interval time.Duration, rules ...*ObjectRetentionRule) (ObjectReaper, error)
+
+	// UploadDir uploads the files of the directory tree that changed.
+	UploadDir(dir string, opts ...SyncOpt) (*ObjectSyncReport, error)
+	// DownloadDir downloads the objects that changed into the directory.
+	DownloadDir(dir string, opts ...SyncOpt) (*ObjectSyncReport, error)
+	// ExportTar writes the objects, and their meta data, as a tar archive.
+	ExportTar(w io.Writer, opts ...SyncOpt) error
+	// ImportTar places the files of a tar archive into objects.
+	ImportTar(r io.Reader, opts ...SyncOpt) (*ObjectSyncReport, error)
+
+	// Audit checks the objects and reports the chunks not referenced by any
+	// object, optionally purging them.
+	Audit(opts ...AuditOpt) (*ObjectAuditReport, error)
 }
 
 type ObjectOpt interface {
@@ -106,6 +151,18 @@ type ObjectOpt interface {
 
 type objOpts struct {
 	ctx context.Context
+	// Range of the object to get.
+	rng *objRange
+	// Upload options.
+	resumable bool
+	resume    *ObjectUploadProgress
+	window    int
+	progress  func(p *ObjectUploadProgress)
+}
+
+type objRange struct {
+	offset int64
+	length int64
 }
 
 // For nats.Context() support.
@@ -114,6 +171,161 @@ func (ctx ContextOpt) configureObject(opts *objOpts) error {
 	return nil
 }
 
+type objOptFn func(opts *objOpts) error
+
+func (opt objOptFn) configureObject(opts *objOpts) error {
+	return opt(opts)
+}
+
+// ObjectRange instructs Get to only return length bytes of the object,
+// starting at offset. A length of 0 means up to the end of the object.
+// Only the chunks holding the range are fetched, and since the object is
+// not read entirely, its digest is not verified.
+func ObjectRange(offset, length int64) ObjectOpt {
+	return objOptFn(func(opts *objOpts) error {
+		if offset < 0 || length < 0 {
+			return ErrInvalidObjectRange
+		}
+		opts.rng = &objRange{offset: offset, length: length}
+		return nil
+	})
+}
+
+// ListObjectsOpt is used to configure ListObjects.
+type ListObjectsOpt interface {
+	configureListObjects(opts *listObjectsOpts) error
+}
+
+type listObjectsOpts struct {
+	prefix         string
+	delimiter      string
+	limit          int
+	cursor         string
+	excludeDeleted bool
+}
+
+type listObjectsOptFn func(opts *listObjectsOpts) error
+
+func (opt listObjectsOptFn) configureListObjects(opts *listObjectsOpts) error {
+	return opt(opts)
+}
+
+// ListPrefix only lists the objects whose name starts with prefix.
+func ListPrefix(prefix string) ListObjectsOpt {
+	return listObjectsOptFn(func(opts *listObjectsOpts) error {
+		opts.prefix = prefix
+		return nil
+	})
+}
+
+// ListDelimiter groups the objects whose name contains the delimiter after
+// the prefix in a common prefix, which ends at the first delimiter. This
+// lists the objects as if the delimiter separated directories.
+func ListDelimiter(delimiter string) ListObjectsOpt {
+	return listObjectsOptFn(func(opts *listObjectsOpts) error {
+		opts.delimiter = delimiter
+		return nil
+	})
+}
+
+// ListLimit sets the maximum number of objects and common prefixes in a page.
+func ListLimit(limit int) ListObjectsOpt {
+	return listObjectsOptFn(func(opts *listObjectsOpts) error {
+		if limit < 0 {
+			return errors.New("nats: list limit should be >= 0")
+		}
+		opts.limit = limit
+		return nil
+	})
+}
+
+// ListCursor continues a listing from the NextCursor of the previous page.
+func ListCursor(cursor string) ListObjectsOpt {
+	return listObjectsOptFn(func(opts *listObjectsOpts) error {
+		opts.cursor = cursor
+		return nil
+	})
+}
+
+// ListExcludeDeleted does not list the deleted objects.
+func ListExcludeDeleted() ListObjectsOpt {
+	return listObjectsOptFn(func(opts *listObjectsOpts) error {
+		opts.excludeDeleted = true
+		return nil
+	})
+}
+
+// ObjectListing is a page of objects returned by ListObjects.
+type ObjectListing struct {
+	// Objects is the meta information of the objects, in name order.
+	Objects []*ObjectInfo
+	// CommonPrefixes are the groups of objects found when a delimiter is set.
+	CommonPrefixes []string
+	// NextCursor is set when there may be more objects to list, and should
+	// be given to ListCursor to list the next page.
+	NextCursor string
+}
+
+// ObjectUploadProgress describes how much of an object has been uploaded and
+// acknowledged by the server. It can be saved, and given to ResumeUpload()
+// to continue an upload that was interrupted.
+type ObjectUploadProgress struct {
+	Name      string `json:"name"`
+	NUID      string `json:"nuid"`
+	ChunkSize uint32 `json:"chunk_size"`
+	Chunks    uint32 `json:"chunks"`
+	Size      uint64 `json:"size"`
+	// Digest is the state of the digest of the data acknowledged so far.
+	Digest []byte `json:"digest,omitempty"`
+}
+
+// ResumableUpload instructs Put to keep the chunks already uploaded if the
+// upload fails, so that it can be continued with ResumeUpload().
+func ResumableUpload() ObjectOpt {
+	return objOptFn(func(opts *objOpts) error {
+		opts.resumable = true
+		return nil
+	})
+}
+
+// ResumeUpload instructs Put to continue an interrupted upload from the given
+// progress. The reader must provide the same data than the original upload
+// from its start. If it is an io.Seeker, it will be positioned after the data
+// that was already uploaded, otherwise that data is read and discarded.
+// The upload remains resumable.
+func ResumeUpload(p *ObjectUploadProgress) ObjectOpt {
+	return objOptFn(func(opts *objOpts) error {
+		if p == nil {
+			return ErrBadUploadProgress
+		}
+		opts.resumable = true
+		opts.resume = p
+		return nil
+	})
+}
+
+// UploadWindow sets the maximum number of chunks that Put can publish
+// without having received their acknowledgement.
+func UploadWindow(chunks int) ObjectOpt {
+	return objOptFn(func(opts *objOpts) error {
+		if chunks < 1 {
+			return errors.New("nats: upload window should be >= 1")
+		}
+		opts.window = chunks
+		return nil
+	})
+}
+
+// UploadProgress sets a callback that Put invokes, in order, each time a chunk
+// is acknowledged by the server. The progress can be recorded to resume the
+// upload if it is interrupted, see ResumableUpload().
+func UploadProgress(cb func(p *ObjectUploadProgress)) ObjectOpt {
+	return objOptFn(func(opts *objOpts) error {
+		opts.progress = cb
+		return nil
+	})
+}
+
 // ObjectWatcher is what is returned when doing a watch.
 type ObjectWatcher interface {
 	// Updates returns a channel to read any updates to entries.
@@ -133,6 +345,14 @@ var (
 	ErrObjectAlreadyExists  = errors.New("nats: an object already exists with that name")
 	ErrNameRequired         = errors.New("nats: name is required")
 	ErrNeeds262             = errors.New("nats: object-store requires at least server version 2.6.2")
+	ErrInvalidObjectRange   = errors.New("nats: invalid object range")
+	ErrBadUploadProgress    = errors.New("nats: upload progress does not match the object")
+	ErrNotVersioned         = errors.New("nats: object store is not versioned")
+	ErrVersionNotFound      = errors.New("nats: object version not found")
+	ErrBadListCursor        = errors.New("nats: invalid list cursor")
+	ErrObjectWriterClosed   = errors.New("nats: object writer closed")
+	ErrBadObjectChunks      = errors.New("nats: object chunks do not match the object info")
+	ErrObjectWatchRevision  = errors.New("nats: object watcher can not persist revisions, use WatchEvents")
 )
 
 // ObjectStoreConfig is the config for the object store.
@@ -144,6 +364,14 @@ type ObjectStoreConfig struct {
 	Storage     StorageType
 	Replicas    int
 	Placement   *Placement
+	// Versions is the number of previous versions of each object that are
+	// retained when it is replaced or deleted. Setting it, or VersionsMaxAge,
+	// makes the bucket versioned.
+	Versions int
+	// VersionsMaxAge is how long previous versions are retained. Versions are
+	// only pruned when the object is written, deleted or restored, so older
+	// versions remain listed and readable until then.
+	VersionsMaxAge time.Duration
 }
 
 type ObjectStoreStatus interface {
@@ -176,6 +404,9 @@ type ObjectMeta struct {
 	Name        string `json:"name"`
 	Description string `json:"description,omitempty"`
 	Headers     Header `json:"headers,omitempty"`
+	// Expires is when the object expires. Expired objects are deleted by
+	// Reap, they remain readable until then.
+	Expires *time.Time `json:"expires,omitempty"`
 
 	// Optional options.
 	Opts *ObjectMetaOptions `json:"options,omitempty"`
@@ -203,18 +434,25 @@ type ObjectLink struct {
 }
 
 // ObjectResult will return the underlying stream info and also be an io.ReadCloser.
+// It is also an io.Seeker and io.ReaderAt, which only fetch the chunks needed
+// to read from the requested position. The digest of the object is verified
+// only when the object is read entirely from the start.
 type ObjectResult interface {
 	io.ReadCloser
+	io.Seeker
+	io.ReaderAt
 	Info() (*ObjectInfo, error)
 	Error() error
 }
 
 const (
+	objNamePre          = "OBJ_"
 	objNameTmpl         = "OBJ_%s"     // OBJ_<bucket> // stream name
 	objAllChunksPreTmpl = "$O.%s.C.>"  // $O.<bucket>.C.> // chunk stream subject
 	objAllMetaPreTmpl   = "$O.%s.M.>"  // $O.<bucket>.M.> // meta stream subject
 	objChunksPreTmpl    = "$O.%s.C.%s" // $O.<bucket>.C.<object-nuid> // chunk message subject
 	objMetaPreTmpl      = "$O.%s.M.%s" // $O.<bucket>.M.<name-encoded> // meta message subject
+	objVersioningTmpl   = "$O.%s.V"    // $O.<bucket>.V // versioning policy subject
 	objNoPending        = "0"
 	objDefaultChunkSize = uint32(128 * 1024) // 128k
 	objDigestType       = "SHA-256="
@@ -225,6 +463,18 @@ type obs struct {
 	name   string
 	stream string
 	js     *js
+	// Transforms applied to the chunks, see ObjectStoreWithTransforms().
+	transforms []ValueTransformer
+	// Set for versioned buckets.
+	versioning *objVersioning
+	// To know if we can use the stream direct get API
+	useDirect bool
+}
+
+// objVersioning is the versioning policy of a bucket.
+type objVersioning struct {
+	Versions int           `json:"versions,omitempty"`
+	MaxAge   time.Duration `json:"max_age,omitempty"`
 }
 
 // CreateObjectStore will create an object store.
@@ -255,10 +505,20 @@ func (js *js) CreateObjectStore(cfg *ObjectStoreConfig) (ObjectStore, error) {
 		maxBytes = -1
 	}
 
+	if cfg.Versions < 0 || cfg.VersionsMaxAge < 0 {
+		return nil, errors.New("nats: invalid object versioning")
+	}
+	var versioning *objVersioning
+	subjects := []string{chunks, meta}
+	if cfg.Versions > 0 || cfg.VersionsMaxAge > 0 {
+		versioning = &objVersioning{Versions: cfg.Versions, MaxAge: cfg.VersionsMaxAge}
+		subjects = append(subjects, fmt.Sprintf(objVersioningTmpl, name))
+	}
+
 	scfg := &StreamConfig{
 		Name:        fmt.Sprintf(objNameTmpl, name),
 		Description: cfg.Description,
-		Subjects:    []string{chunks, meta},
+		Subjects:    subjects,
 		MaxAge:      cfg.TTL,
 		MaxBytes:    maxBytes,
 		Storage:     cfg.Storage,
@@ -270,12 +530,24 @@ func (js *js) CreateObjectStore(cfg *ObjectStoreConfig) (ObjectStore, error) {
 	}
 
 	// Create our stream.
-	_, err := js.AddStream(scfg)
+	si, err := js.AddStream(scfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return &obs{name: name, stream: scfg.Name, js: js}, nil
+	// Record the versioning policy so that it applies to all the handles.
+	if versioning != nil {
+		m := NewMsg(fmt.Sprintf(objVersioningTmpl, name))
+		m.Header.Set(MsgRollup, MsgRollupSubject)
+		if m.Data, err = json.Marshal(versioning); err != nil {
+			return nil, err
+		}
+		if _, err = js.PublishMsg(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return &obs{name: name, stream: scfg.Name, js: js, versioning: versioning, useDirect: si.Config.AllowDirect}, nil
 }
 
 // ObjectStore will look up and bind to an existing object store instance.
@@ -292,7 +564,24 @@ func (js *js) ObjectStore(bucket string) (ObjectStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &obs{name: bucket, stream: si.Config.Name, js: js}, nil
+	obs := &obs{name: bucket, stream: si.Config.Name, js: js, useDirect: si.Config.AllowDirect}
+
+	// Load the versioning policy of versioned buckets.
+	vsubj := fmt.Sprintf(objVersioningTmpl, bucket)
+	for _, subj := range si.Config.Subjects {
+		if subj != vsubj {
+			continue
+		}
+		m, err := js.GetLastMsg(stream, vsubj)
+		if err != nil {
+			return nil, err
+		}
+		obs.versioning = &objVersioning{}
+		if err := json.Unmarshal(m.Data, obs.versioning); err != nil {
+			return nil, err
+		}
+	}
+	return obs, nil
 }
 
 // DeleteObjectStore will delete the underlying stream for the named object.
@@ -301,158 +590,337 @@ func (js *js) DeleteObjectStore(bucket string) error {
 	return js.DeleteStream(stream)
 }
 
+// ObjectStoreNames is used to retrieve a list of object store names.
+func (jsc *js) ObjectStoreNames(opts ...JSOpt) <-chan string {
+	o, cancel, err := getJSContextOpts(jsc.opts, opts...)
+	if err != nil {
+		return nil
+	}
+
+	ch := make(chan string)
+	l := &streamNamesLister{js: &js{nc: jsc.nc, opts: o}}
+	go func() {
+		if cancel != nil {
+			defer cancel()
+		}
+		defer close(ch)
+		for l.Next() {
+			for _, name := range l.Page() {
+				if !strings.HasPrefix(name, objNamePre) {
+					continue
+				}
+				select {
+				case ch <- strings.TrimPrefix(name, objNamePre):
+				case <-o.ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+// ObjectStores is used to retrieve the status of all object stores.
+func (jsc *js) ObjectStores(opts ...JSOpt) <-chan ObjectStoreStatus {
+	o, cancel, err := getJSContextOpts(jsc.opts, opts...)
+	if err != nil {
+		return nil
+	}
+
+	ch := make(chan ObjectStoreStatus)
+	l := &streamLister{js: &js{nc: jsc.nc, opts: o}}
+	go func() {
+		if cancel != nil {
+			defer cancel()
+		}
+		defer close(ch)
+		for l.Next() {
+			for _, info := range l.Page() {
+				if !strings.HasPrefix(info.Config.Name, objNamePre) {
+					continue
+				}
+				status := &ObjectBucketStatus{
+					nfo:    info,
+					bucket: strings.TrimPrefix(info.Config.Name, objNamePre),
+				}
+				select {
+				case ch <- status:
+				case <-o.ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
 func encodeName(name string) string {
 	return base64.URLEncoding.EncodeToString([]byte(name))
 }
 
 // Put will place the contents from the reader into this object-store.
 func (obs *obs) Put(meta *ObjectMeta, r io.Reader, opts ...ObjectOpt) (*ObjectInfo, error) {
+	u, err := obs.newUpload(meta, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer u.stopAcks()
+
+	if u.opts.resume != nil {
+		if u.sent, u.total, err = obs.resumeUpload(u.opts.resume, r, u.h, u.chunk); err != nil {
+			return nil, err
+		}
+	}
+
+	for r != nil {
+		// Actual read.
+		// TODO(dlc) - Deadline?
+		n, readErr := fillChunk(u.opts.ctx, r, u.chunk)
+
+		// Handle all non EOF errors
+		if readErr != nil && readErr != io.EOF {
+			u.purgePartial()
+			return nil, readErr
+		}
+
+		// Add chunk only if we received data
+		if n > 0 {
+			if err := u.sendChunk(u.chunk[:n]); err != nil {
+				u.purgePartial()
+				return nil, err
+			}
+		}
+
+		// EOF Processing.
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	info, err := u.finish(r != nil)
+	if err != nil && err != ErrTimeout && r != nil {
+		u.purgePartial()
+	}
+	return info, err
+}
+
+// objUpload is the state of an object being uploaded, used by Put and
+// PutWriter.
+type objUpload struct {
+	obs     *obs
+	opts    objOpts
+	info    *ObjectInfo
+	einfo   *ObjectInfo
+	js      JetStream
+	pubOpts []PubOpt
+
+	m     *Msg
+	h     hash.Hash
+	chunk []byte
+	sent  int
+	total uint64
+
+	// For async error handling
+	mu   sync.Mutex
+	perr error
+
+	// Track acknowledgements of the chunks to report progress.
+	acks     chan *chunkAck
+	acksDone chan struct{}
+}
+
+type chunkAck struct {
+	paf    PubAckFuture
+	n      int
+	digest []byte
+}
+
+// newUpload prepares the upload of an object.
+func (obs *obs) newUpload(meta *ObjectMeta, opts []ObjectOpt) (*objUpload, error) {
 	if meta == nil || meta.Name == "" {
 		return nil, ErrBadObjectMeta
 	}
 
-	var o objOpts
+	u := &objUpload{obs: obs}
 	for _, opt := range opts {
 		if opt != nil {
-			if err := opt.configureObject(&o); err != nil {
+			if err := opt.configureObject(&u.opts); err != nil {
 				return nil, err
 			}
 		}
 	}
-	ctx := o.ctx
 
-	// Create the new nuid so chunks go on a new subject if the name is re-used
-	newnuid := nuid.Next()
+	chunkSize := objDefaultChunkSize
+	if meta.Opts != nil && meta.Opts.ChunkSize > 0 {
+		chunkSize = meta.Opts.ChunkSize
+	}
 
-	// These will be used in more than one place
-	chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, newnuid)
+	// Create the new nuid so chunks go on a new subject if the name is re-used,
+	// unless we resume an upload.
+	newnuid := nuid.Next()
+	if resume := u.opts.resume; resume != nil {
+		if resume.Name != meta.Name || resume.NUID == _EMPTY_ {
+			return nil, ErrBadUploadProgress
+		}
+		if meta.Opts != nil && meta.Opts.ChunkSize > 0 && meta.Opts.ChunkSize != resume.ChunkSize {
+			return nil, ErrBadUploadProgress
+		}
+		newnuid, chunkSize = resume.NUID, resume.ChunkSize
+	}
 
 	// Grab existing meta info (einfo). Ok to be found or not found, any other error is a problem
 	// Chunks on the old nuid can be cleaned up at the end
-	einfo, err := obs.GetInfo(meta.Name) // GetInfo will encode the name
+	var err error
+	u.einfo, err = obs.GetInfo(meta.Name) // GetInfo will encode the name
 	if err != nil && err != ErrObjectNotFound {
 		return nil, err
 	}
 
-	// For async error handling
-	var perr error
-	var mu sync.Mutex
-	setErr := func(err error) {
-		mu.Lock()
-		defer mu.Unlock()
-		perr = err
+	// Create our own JS context to handle errors etc.
+	jsOpts := []JSOpt{PublishAsyncErrHandler(func(js JetStream, _ *Msg, err error) { u.setErr(err) })}
+	if u.opts.window > 0 {
+		// The limit accounts for the message being published.
+		jsOpts = append(jsOpts, PublishAsyncMaxPending(u.opts.window+1))
+		u.pubOpts = append(u.pubOpts, StallWait(obs.js.opts.wait))
 	}
-	getErr := func() error {
-		mu.Lock()
-		defer mu.Unlock()
-		return perr
+	if u.js, err = obs.js.nc.JetStream(jsOpts...); err != nil {
+		return nil, err
 	}
 
-	purgePartial := func() { obs.js.purgeStream(obs.stream, &StreamPurgeRequest{Subject: chunkSubj}) }
+	// set up the info object. The chunk upload sets the size and digest
+	u.info = &ObjectInfo{Bucket: obs.name, NUID: newnuid, ObjectMeta: *meta}
+	u.m, u.h = NewMsg(fmt.Sprintf(objChunksPreTmpl, obs.name, newnuid)), sha256.New()
+	u.chunk = make([]byte, chunkSize)
+	return u, nil
+}
 
-	// Create our own JS context to handle errors etc.
-	js, err := obs.js.nc.JetStream(PublishAsyncErrHandler(func(js JetStream, _ *Msg, err error) { setErr(err) }))
-	if err != nil {
-		return nil, err
+func (u *objUpload) setErr(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.perr = err
+}
+
+func (u *objUpload) getErr() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.perr
+}
+
+// purgePartial removes the chunks uploaded, except for resumable uploads
+// that keep the chunks that made it to the server.
+func (u *objUpload) purgePartial() {
+	if !u.opts.resumable {
+		u.obs.js.purgeStream(u.obs.stream, &StreamPurgeRequest{Subject: u.m.Subject})
 	}
+}
 
-	chunkSize := objDefaultChunkSize
-	if meta.Opts != nil && meta.Opts.ChunkSize > 0 {
-		chunkSize = meta.Opts.ChunkSize
+// sendChunk adds the data to the digest and publishes it as the next chunk.
+func (u *objUpload) sendChunk(data []byte) error {
+	if u.opts.progress != nil && u.acks == nil {
+		u.startAcks()
 	}
 
-	m, h := NewMsg(chunkSubj), sha256.New()
-	chunk, sent, total := make([]byte, chunkSize), 0, uint64(0)
+	// Chunk processing.
+	m := u.m
+	m.Data = data
+	u.h.Write(m.Data)
+	if len(u.obs.transforms) > 0 {
+		m.Header = Header{}
+		if err := encodeValue(u.obs.transforms, m.Subject, m); err != nil {
+			return err
+		}
+	}
 
-	// set up the info object. The chunk upload sets the size and digest
-	info := &ObjectInfo{Bucket: obs.name, NUID: newnuid, ObjectMeta: *meta}
+	// Send msg itself.
+	paf, err := u.js.PublishMsgAsync(m, u.pubOpts...)
+	if err != nil {
+		return err
+	}
+	if err := u.getErr(); err != nil {
+		return err
+	}
+	if u.acks != nil {
+		digest, _ := u.h.(encoding.BinaryMarshaler).MarshalBinary()
+		u.acks <- &chunkAck{paf: paf, n: len(data), digest: digest}
+	}
+	// Update totals.
+	u.sent++
+	u.total += uint64(len(data))
+	return nil
+}
 
-	for r != nil {
-		if ctx != nil {
+// startAcks reports the progress of the upload as the chunks are acknowledged.
+func (u *objUpload) startAcks() {
+	u.acks, u.acksDone = make(chan *chunkAck, 64), make(chan struct{})
+	progress := &ObjectUploadProgress{
+		Name:      u.info.Name,
+		NUID:      u.info.NUID,
+		ChunkSize: uint32(len(u.chunk)),
+		Chunks:    uint32(u.sent),
+		Size:      u.total,
+	}
+	go func(acks chan *chunkAck, done chan struct{}) {
+		defer close(done)
+		for ack := range acks {
 			select {
-			case <-ctx.Done():
-				if ctx.Err() == context.Canceled {
-					err = ctx.Err()
-				} else {
-					err = ErrTimeout
+			case <-ack.paf.Ok():
+			case err := <-ack.paf.Err():
+				u.setErr(err)
+				// Drain the rest, we can not report progress past this point.
+				for range acks {
 				}
-			default:
-			}
-			if err != nil {
-				purgePartial()
-				return nil, err
+				return
 			}
+			progress.Chunks++
+			progress.Size += uint64(ack.n)
+			progress.Digest = ack.digest
+			p := *progress
+			u.opts.progress(&p)
 		}
+	}(u.acks, u.acksDone)
+}
 
-		// Actual read.
-		// TODO(dlc) - Deadline?
-		n, readErr := r.Read(chunk)
-
-		// Handle all non EOF errors
-		if readErr != nil && readErr != io.EOF {
-			purgePartial()
-			return nil, readErr
-		}
-
-		// Add chunk only if we received data
-		if n > 0 {
-			// Chunk processing.
-			m.Data = chunk[:n]
-			h.Write(m.Data)
+func (u *objUpload) stopAcks() {
+	if u.acks != nil {
+		close(u.acks)
+		<-u.acksDone
+		u.acks = nil
+	}
+}
 
-			// Send msg itself.
-			if _, err := js.PublishMsgAsync(m); err != nil {
-				purgePartial()
-				return nil, err
-			}
-			if err := getErr(); err != nil {
-				purgePartial()
-				return nil, err
-			}
-			// Update totals.
-			sent++
-			total += uint64(n)
-		}
+// finish publishes the meta info once all the chunks are sent, and waits
+// for all of them to be acknowledged. Only uploads with data have a size
+// and a digest, links and Put with a nil reader have none.
+func (u *objUpload) finish(withData bool) (*ObjectInfo, error) {
+	obs, info := u.obs, u.info
 
-		// EOF Processing.
-		if readErr == io.EOF {
-			// Finalize sha.
-			sha := h.Sum(nil)
-			// Place meta info.
-			info.Size, info.Chunks = uint64(total), uint32(sent)
-			info.Digest = fmt.Sprintf(objDigestTmpl, base64.URLEncoding.EncodeToString(sha[:]))
-			break
-		}
+	// Finalize sha.
+	if withData {
+		sha := u.h.Sum(nil)
+		// Place meta info.
+		info.Size, info.Chunks = uint64(u.total), uint32(u.sent)
+		info.Digest = fmt.Sprintf(objDigestTmpl, base64.URLEncoding.EncodeToString(sha[:]))
 	}
 
 	// Prepare the meta message
-	metaSubj := fmt.Sprintf(objMetaPreTmpl, obs.name, encodeName(meta.Name))
-	mm := NewMsg(metaSubj)
-	mm.Header.Set(MsgRollup, MsgRollupSubject)
-	mm.Data, err = json.Marshal(info)
+	mm, err := obs.metaMsg(info)
 	if err != nil {
-		if r != nil {
-			purgePartial()
-		}
 		return nil, err
 	}
 
 	// Publish the meta message.
-	_, err = js.PublishMsgAsync(mm)
+	_, err = u.js.PublishMsgAsync(mm, u.pubOpts...)
 	if err != nil {
-		if r != nil {
-			purgePartial()
-		}
 		return nil, err
 	}
 
 	// Wait for all to be processed.
 	select {
-	case <-js.PublishAsyncComplete():
-		if err := getErr(); err != nil {
-			if r != nil {
-				purgePartial()
-			}
+	case <-u.js.PublishAsyncComplete():
+		u.stopAcks()
+		if err := u.getErr(); err != nil {
 			return nil, err
 		}
 	case <-time.After(obs.js.opts.wait):
@@ -461,8 +929,16 @@ func (obs *obs) Put(meta *ObjectMeta, r io.Reader, opts ...ObjectOpt) (*ObjectIn
 
 	info.ModTime = time.Now().UTC() // This time is not actually the correct time
 
+	// Versioned buckets keep the original chunks.
+	if obs.versioning != nil {
+		if err := obs.pruneVersions(info.Name); err != nil {
+			return nil, err
+		}
+		return info, nil
+	}
+
 	// Delete any original chunks.
-	if einfo != nil && !einfo.Deleted {
+	if einfo := u.einfo; einfo != nil && !einfo.Deleted && einfo.NUID != info.NUID {
 		echunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, einfo.NUID)
 		obs.js.purgeStream(obs.stream, &StreamPurgeRequest{Subject: echunkSubj})
 	}
@@ -475,20 +951,241 @@ func (obs *obs) Put(meta *ObjectMeta, r io.Reader, opts ...ObjectOpt) (*ObjectIn
 	return info, nil
 }
 
+// ObjectWriter is returned by PutWriter. The object is placed in the store
+// when the writer is closed. An ObjectWriter is not safe for concurrent use.
+type ObjectWriter interface {
+	io.WriteCloser
+	// Abort abandons the upload. The chunks already uploaded are purged,
+	// unless the upload is resumable.
+	Abort() error
+	// Info returns the information of the object once the writer is closed.
+	Info() *ObjectInfo
+}
+
+// PutWriter returns a writer placing the data written into a new object,
+// which is created when the writer is closed.
+func (obs *obs) PutWriter(meta *ObjectMeta, opts ...ObjectOpt) (ObjectWriter, error) {
+	u, err := obs.newUpload(meta, opts)
+	if err != nil {
+		return nil, err
+	}
+	if u.opts.resume != nil {
+		return nil, errors.New("nats: uploads can not be resumed by a writer")
+	}
+	return &objWriter{u: u}, nil
+}
+
+// Implementation for ObjectWriter
+type objWriter struct {
+	u *objUpload
+	// Number of bytes in the current chunk.
+	n    int
+	info *ObjectInfo
+	err  error
+}
+
+// Write fills the current chunk, which is sent when full.
+func (w *objWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	var written int
+	for len(p) > 0 {
+		if err := checkCtx(w.u.opts.ctx); err != nil {
+			return written, w.fail(err)
+		}
+		c := copy(w.u.chunk[w.n:], p)
+		w.n += c
+		written += c
+		p = p[c:]
+		if w.n == len(w.u.chunk) {
+			if err := w.u.sendChunk(w.u.chunk); err != nil {
+				return written, w.fail(err)
+			}
+			w.n = 0
+		}
+	}
+	return written, nil
+}
+
+// fail abandons the upload, the error is returned for any further call.
+func (w *objWriter) fail(err error) error {
+	w.u.stopAcks()
+	w.u.purgePartial()
+	w.err = err
+	return err
+}
+
+// Close sends the last chunk and places the meta info of the object.
+func (w *objWriter) Close() error {
+	if w.info != nil {
+		return nil
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if w.n > 0 {
+		if err := w.u.sendChunk(w.u.chunk[:w.n]); err != nil {
+			return w.fail(err)
+		}
+		w.n = 0
+	}
+	info, err := w.u.finish(true)
+	if err != nil {
+		if err == ErrTimeout {
+			w.u.stopAcks()
+			w.err = err
+			return err
+		}
+		return w.fail(err)
+	}
+	w.info, w.err = info, ErrObjectWriterClosed
+	return nil
+}
+
+// Abort abandons the upload.
+func (w *objWriter) Abort() error {
+	if w.info != nil {
+		return ErrObjectWriterClosed
+	}
+	if w.err == nil {
+		w.fail(ErrObjectWriterClosed)
+	}
+	return nil
+}
+
+// Info returns the information of the object once the writer is closed.
+func (w *objWriter) Info() *ObjectInfo {
+	return w.info
+}
+
+// resumeUpload checks the chunks already stored for an interrupted upload,
+// restores the digest and skips the data that was already uploaded.
+// It returns the number of chunks and bytes already uploaded.
+func (obs *obs) resumeUpload(p *ObjectUploadProgress, r io.Reader, h hash.Hash, chunk []byte) (int, uint64, error) {
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(p.Digest); err != nil && p.Chunks > 0 {
+		return 0, 0, ErrBadUploadProgress
+	}
+	chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, p.NUID)
+	si, err := obs.js.StreamInfo(obs.stream, &StreamInfoRequest{SubjectsFilter: chunkSubj})
+	if err != nil {
+		return 0, 0, err
+	}
+	stored := si.State.Subjects[chunkSubj]
+	if stored < uint64(p.Chunks) {
+		return 0, 0, ErrBadUploadProgress
+	}
+
+	// Position the reader after the data that was acknowledged.
+	if p.Size > 0 {
+		if s, ok := r.(io.Seeker); ok {
+			_, err = s.Seek(int64(p.Size), io.SeekStart)
+		} else {
+			_, err = io.CopyN(ioutil.Discard, r, int64(p.Size))
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// Chunks could have been stored without their acknowledgement being
+	// recorded, those are skipped from the reader too.
+	sent, total := int(p.Chunks), p.Size
+	for ; uint64(sent) < stored; sent++ {
+		n, err := io.ReadFull(r, chunk)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, 0, err
+		}
+		h.Write(chunk[:n])
+		total += uint64(n)
+	}
+	return sent, total, nil
+}
+
+// fillChunk reads until the chunk is full or the reader is exhausted, so that
+// all chunks but the last one have the same size, which allows ranged reads.
+// The context, if any, is checked between reads.
+func fillChunk(ctx context.Context, r io.Reader, chunk []byte) (int, error) {
+	var n int
+	for n < len(chunk) {
+		if err := checkCtx(ctx); err != nil {
+			return n, err
+		}
+		nr, err := r.Read(chunk[n:])
+		n += nr
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// checkCtx returns an error if the context, if any, is done.
+func checkCtx(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			return ctx.Err()
+		}
+		return ErrTimeout
+	default:
+		return nil
+	}
+}
+
 // ObjectResult impl.
 type objResult struct {
 	sync.Mutex
+	obs    *obs
 	info   *ObjectInfo
-	r      io.ReadCloser
+	r      net.Conn
 	err    error
 	ctx    context.Context
 	digest hash.Hash
+	// Absolute offset and length of the range of the object that is
+	// exposed by this result, and current position in that range.
+	base   int64
+	limit  int64
+	pos    int64
+	closed bool
+	// Error of the current fetch, errors of fetches replaced
+	// after a seek are ignored.
+	ferr *fetchErr
+}
+
+// fetchErr holds the error that stopped a fetch. It is set before the
+// pipe is closed, so that the reader sees it instead of a plain EOF.
+type fetchErr struct {
+	sync.Mutex
+	err error
+}
+
+func (f *fetchErr) set(err error) {
+	f.Lock()
+	f.err = err
+	f.Unlock()
+}
+
+func (f *fetchErr) get() error {
+	f.Lock()
+	defer f.Unlock()
+	return f.err
 }
 
 func (info *ObjectInfo) isLink() bool {
 	return info.ObjectMeta.Opts != nil && info.ObjectMeta.Opts.Link != nil
 }
 
+func (info *ObjectInfo) chunkSize() int64 {
+	if info.ObjectMeta.Opts != nil && info.ObjectMeta.Opts.ChunkSize > 0 {
+		return int64(info.ObjectMeta.Opts.ChunkSize)
+	}
+	return int64(objDefaultChunkSize)
+}
+
 // Get will pull the object from the underlying stream.
 func (obs *obs) Get(name string, opts ...ObjectOpt) (ObjectResult, error) {
 	// Grab meta info.
@@ -496,6 +1193,11 @@ func (obs *obs) Get(name string, opts ...ObjectOpt) (ObjectResult, error) {
 	if err != nil {
 		return nil, err
 	}
+	return obs.getObject(info, opts...)
+}
+
+// getObject pulls the object described by the meta info.
+func (obs *obs) getObject(info *ObjectInfo, opts ...ObjectOpt) (ObjectResult, error) {
 	if info.NUID == _EMPTY_ {
 		return nil, ErrBadObjectMeta
 	}
@@ -509,7 +1211,7 @@ func (obs *obs) Get(name string, opts ...ObjectOpt) (ObjectResult, error) {
 		// is the link in the same bucket?
 		lbuck := info.ObjectMeta.Opts.Link.Bucket
 		if lbuck == obs.name {
-			return obs.Get(info.ObjectMeta.Opts.Link.Name)
+			return obs.Get(info.ObjectMeta.Opts.Link.Name, opts...)
 		}
 
 		// different bucket
@@ -517,7 +1219,7 @@ func (obs *obs) Get(name string, opts ...ObjectOpt) (ObjectResult, error) {
 		if err != nil {
 			return nil, err
 		}
-		return lobs.Get(info.ObjectMeta.Opts.Link.Name)
+		return lobs.Get(info.ObjectMeta.Opts.Link.Name, opts...)
 	}
 
 	var o objOpts
@@ -528,26 +1230,63 @@ func (obs *obs) Get(name string, opts ...ObjectOpt) (ObjectResult, error) {
 			}
 		}
 	}
-	ctx := o.ctx
 
-	result := &objResult{info: info, ctx: ctx}
-	if info.Size == 0 {
+	result := &objResult{obs: obs, info: info, ctx: o.ctx, limit: int64(info.Size)}
+	if o.rng != nil {
+		if o.rng.offset > int64(info.Size) {
+			return nil, ErrInvalidObjectRange
+		}
+		result.base = o.rng.offset
+		result.limit = int64(info.Size) - o.rng.offset
+		if o.rng.length > 0 && o.rng.length < result.limit {
+			result.limit = o.rng.length
+		}
+	}
+	if result.limit == 0 {
 		return result, nil
 	}
 
+	result.Lock()
+	err := result.fetch()
+	result.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// fetch starts delivering the chunks needed to read from the current
+// position to the end of the range. Lock should be held.
+func (o *objResult) fetch() error {
+	ferr := &fetchErr{}
+	o.ferr = ferr
+	start, end := o.base+o.pos, o.base+o.limit
+	info, ctx := o.info, o.ctx
+
+	// If we read the whole object we can check the digest.
+	o.digest = nil
+	if start == 0 && end == int64(info.Size) {
+		o.digest = sha256.New()
+	}
+	digest := o.digest
+
+	// Chunks have a fixed size, except for the last one, so we can
+	// go straight to the chunk that holds the start position.
+	chunkSize := info.chunkSize()
+	first := uint64(start / chunkSize)
+	offset := int64(-1)
+
 	pr, pw := net.Pipe()
-	result.r = pr
+	o.r = pr
 
 	gotErr := func(m *Msg, err error) {
+		ferr.set(err)
 		pw.Close()
 		m.Sub.Unsubscribe()
-		result.setErr(err)
 	}
 
-	// For calculating sum256
-	result.digest = sha256.New()
-
 	processChunk := func(m *Msg) {
+		var err error
 		if ctx != nil {
 			select {
 			case <-ctx.Done():
@@ -569,9 +1308,59 @@ func (obs *obs) Get(name string, opts ...ObjectOpt) (ObjectResult, error) {
 			gotErr(m, err)
 			return
 		}
+		pending := uint64(parseNum(tokens[ackNumPendingTokenPos]))
+		if offset < 0 {
+			// Chunks of other objects could have been interleaved, so
+			// we may start before the chunk we are looking for.
+			idx := uint64(info.Chunks) - 1 - pending
+			if idx < first {
+				return
+			}
+			offset = int64(idx) * chunkSize
+		}
+		data, err := decodeValue(o.obs.transforms, m.Subject, chunkSize, m.Header, m.Data)
+		if err != nil {
+			gotErr(m, err)
+			return
+		}
+		// Positions derived from the chunk index are only right if all the
+		// chunks have the full size, except for the last one. Objects written
+		// by other clients may have shorter chunks, in which case we can not
+		// tell where the data is and fail rather than hand out the wrong data.
+		// Reading from the start does not depend on the size of the chunks.
+		if first > 0 {
+			idx := uint64(info.Chunks) - 1 - pending
+			expected := chunkSize
+			if pending == 0 {
+				expected = int64(info.Size) - int64(idx)*chunkSize
+			}
+			if int64(len(data)) != expected {
+				gotErr(m, ErrBadObjectChunks)
+				return
+			}
+		}
+		// Update sha256
+		if digest != nil {
+			digest.Write(data)
+		}
+
+		// Only write the part of the chunk that is in range.
+		cstart := offset
+		offset += int64(len(data))
+		b := data
+		if offset > end {
+			b = b[:int64(len(b))-(offset-end)]
+		}
+		if cstart < start {
+			if skip := start - cstart; skip < int64(len(b)) {
+				b = b[skip:]
+			} else {
+				b = nil
+			}
+		}
 
 		// Write to our pipe.
-		for b := m.Data; len(b) > 0; {
+		for len(b) > 0 {
 			n, err := pw.Write(b)
 			if err != nil {
 				gotErr(m, err)
@@ -579,23 +1368,39 @@ func (obs *obs) Get(name string, opts ...ObjectOpt) (ObjectResult, error) {
 			}
 			b = b[n:]
 		}
-		// Update sha256
-		result.digest.Write(m.Data)
 
 		// Check if we are done.
-		if tokens[ackNumPendingTokenPos] == objNoPending {
+		if pending == 0 || offset >= end {
 			pw.Close()
 			m.Sub.Unsubscribe()
 		}
 	}
 
-	chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, info.NUID)
-	_, err = obs.js.Subscribe(chunkSubj, processChunk, OrderedConsumer())
-	if err != nil {
-		return nil, err
+	chunkSubj := fmt.Sprintf(objChunksPreTmpl, o.obs.name, info.NUID)
+	subOpts := []SubOpt{OrderedConsumer()}
+	if first > 0 && o.obs.useDirect {
+		// Find where the chunks of this object start in the stream. If the
+		// stream does not allow direct gets or that fails, we will simply
+		// skip the chunks we do not need.
+		if m, err := o.obs.js.GetMsg(o.obs.stream, 1, DirectGetNext(chunkSubj)); err == nil {
+			subOpts = append(subOpts, StartSequence(m.Sequence+first))
+		}
+	}
+	if _, err := o.obs.js.Subscribe(chunkSubj, processChunk, subOpts...); err != nil {
+		pr.Close()
+		o.r = nil
+		return err
 	}
+	return nil
+}
 
-	return result, nil
+// stop will stop reading the chunks, the subscription will be removed
+// when the next chunk fails to be written to the pipe. Lock should be held.
+func (o *objResult) stop() {
+	if o.r != nil {
+		o.r.Close()
+		o.r = nil
+	}
 }
 
 // Delete will delete the object.
@@ -613,23 +1418,207 @@ func (obs *obs) Delete(name string) error {
 	info.Deleted = true
 	info.Size, info.Chunks, info.Digest = 0, 0, _EMPTY_
 
-	metaSubj := fmt.Sprintf(objMetaPreTmpl, obs.name, encodeName(name))
-	mm := NewMsg(metaSubj)
-	mm.Data, err = json.Marshal(info)
+	mm, err := obs.metaMsg(info)
 	if err != nil {
 		return err
 	}
-	mm.Header.Set(MsgRollup, MsgRollupSubject)
 	_, err = obs.js.PublishMsg(mm)
 	if err != nil {
 		return err
 	}
 
+	// Versioned buckets keep the chunks, the marker is a new version.
+	if obs.versioning != nil {
+		return obs.pruneVersions(name)
+	}
+
 	// Purge chunks for the object.
 	chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, info.NUID)
 	return obs.js.purgeStream(obs.stream, &StreamPurgeRequest{Subject: chunkSubj})
 }
 
+// objVersion is a meta info retained for an object, and its sequence.
+type objVersion struct {
+	info *ObjectInfo
+	seq  uint64
+}
+
+// versions returns the meta infos retained for the named object, oldest first.
+func (obs *obs) versions(name string) ([]*objVersion, error) {
+	if name == _EMPTY_ {
+		return nil, ErrNameRequired
+	}
+	return obs.metaVersions(fmt.Sprintf(objMetaPreTmpl, obs.name, encodeName(name)))
+}
+
+// metaVersions returns the meta infos retained on the meta subject, oldest first.
+func (obs *obs) metaVersions(metaSubj string) ([]*objVersion, error) {
+	var vs []*objVersion
+	err := obs.readMsgs(metaSubj, func(m *Msg, meta *MsgMetadata) error {
+		var info ObjectInfo
+		if err := json.Unmarshal(m.Data, &info); err != nil {
+			return ErrBadObjectMeta
+		}
+		info.ModTime = meta.Timestamp
+		vs = append(vs, &objVersion{info: &info, seq: meta.Sequence.Stream})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(vs) == 0 {
+		return nil, ErrObjectNotFound
+	}
+	return vs, nil
+}
+
+// readMsgs reads the messages stored on the subject, in stream order, with
+// an ordered consumer. Reading stops at the first error returned by cb.
+func (obs *obs) readMsgs(subj string, cb func(m *Msg, meta *MsgMetadata) error) error {
+	sub, err := obs.js.SubscribeSync(subj, OrderedConsumer())
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	sub.mu.Lock()
+	empty := sub.jsi != nil && sub.jsi.pending == 0
+	sub.mu.Unlock()
+	for !empty {
+		m, err := sub.NextMsg(obs.js.opts.wait)
+		if err != nil {
+			return err
+		}
+		meta, err := m.Metadata()
+		if err != nil {
+			return err
+		}
+		if err := cb(m, meta); err != nil {
+			return err
+		}
+		empty = meta.NumPending == 0
+	}
+	return nil
+}
+
+// findVersion returns the latest version of the named object with this NUID
+// that is not a delete marker.
+func (obs *obs) findVersion(name, nuid string) (*ObjectInfo, bool, error) {
+	vs, err := obs.versions(name)
+	if err != nil {
+		return nil, false, err
+	}
+	for i := len(vs) - 1; i >= 0; i-- {
+		if info := vs[i].info; info.NUID == nuid && !info.Deleted {
+			return info, i == len(vs)-1, nil
+		}
+	}
+	return nil, false, ErrVersionNotFound
+}
+
+// Versions returns the versions of the named object, oldest first.
+func (obs *obs) Versions(name string) ([]*ObjectInfo, error) {
+	vs, err := obs.versions(name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*ObjectInfo, 0, len(vs))
+	for _, v := range vs {
+		infos = append(infos, v.info)
+	}
+	return infos, nil
+}
+
+// GetVersion will pull the version of the named object with this NUID.
+func (obs *obs) GetVersion(name, nuid string, opts ...ObjectOpt) (ObjectResult, error) {
+	info, _, err := obs.findVersion(name, nuid)
+	if err != nil {
+		return nil, err
+	}
+	return obs.getObject(info, opts...)
+}
+
+// RestoreVersion publishes the meta info of a previous version of the named
+// object so that it is the current version again.
+func (obs *obs) RestoreVersion(name, nuid string) (*ObjectInfo, error) {
+	if obs.versioning == nil {
+		return nil, ErrNotVersioned
+	}
+	info, current, err := obs.findVersion(name, nuid)
+	if err != nil || current {
+		return info, err
+	}
+	mm, err := obs.metaMsg(info)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := obs.js.PublishMsg(mm); err != nil {
+		return nil, err
+	}
+	info.ModTime = time.Now().UTC()
+	if err := obs.pruneVersions(name); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// pruneVersions removes the versions of the named object that are beyond
+// the versioning policy of the bucket. The current version is always kept.
+func (obs *obs) pruneVersions(name string) error {
+	vs, err := obs.versions(name)
+	if err != nil {
+		return err
+	}
+	current, start := len(vs)-1, 0
+	if n := obs.versioning.Versions; n > 0 && current > n {
+		start = current - n
+	}
+	if maxAge := obs.versioning.MaxAge; maxAge > 0 {
+		for start < current && time.Since(vs[start].info.ModTime) > maxAge {
+			start++
+		}
+	}
+	if start == 0 {
+		return nil
+	}
+	inUse := make(map[string]struct{})
+	for _, v := range vs[start:] {
+		if !v.info.Deleted {
+			inUse[v.info.NUID] = struct{}{}
+		}
+	}
+	return obs.dropVersions(vs[:start], inUse)
+}
+
+// removeVersions removes the versions of the named object, except the chunks
+// of the given NUID.
+func (obs *obs) removeVersions(name, nuid string) error {
+	vs, err := obs.versions(name)
+	if err != nil {
+		return err
+	}
+	return obs.dropVersions(vs, map[string]struct{}{nuid: {}})
+}
+
+// dropVersions deletes the meta info of the versions, and purges their
+// chunks unless they are in use.
+func (obs *obs) dropVersions(vs []*objVersion, inUse map[string]struct{}) error {
+	for _, v := range vs {
+		if err := obs.js.DeleteMsg(obs.stream, v.seq); err != nil && err != ErrMsgNotFound {
+			return err
+		}
+		if _, ok := inUse[v.info.NUID]; ok || v.info.Deleted {
+			continue
+		}
+		inUse[v.info.NUID] = struct{}{}
+		chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, v.info.NUID)
+		if err := obs.js.purgeStream(obs.stream, &StreamPurgeRequest{Subject: chunkSubj}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // AddLink will add a link to another object if it's not deleted and not another link
 // name is the name of this link object
 // obj is what is being linked too
@@ -782,10 +1771,19 @@ func (obs *obs) GetInfo(name string) (*ObjectInfo, error) {
 		return nil, ErrNameRequired
 	}
 
-	metaSubj := fmt.Sprintf(objMetaPreTmpl, obs.name, encodeName(name)) // used as data in a JS API call
-	stream := fmt.Sprintf(objNameTmpl, obs.name)
+	return obs.lastMeta(name, false)
+}
 
-	m, err := obs.js.GetLastMsg(stream, metaSubj)
+// lastMeta returns the latest meta information of the object. With direct,
+// a direct get is used if the stream allows it, which may be answered by a
+// replica not up to date yet.
+func (obs *obs) lastMeta(name string, direct bool) (*ObjectInfo, error) {
+	metaSubj := fmt.Sprintf(objMetaPreTmpl, obs.name, encodeName(name)) // used as data in a JS API call
+	var opts []JSOpt
+	if direct && obs.useDirect {
+		opts = append(opts, DirectGet())
+	}
+	m, err := obs.js.GetLastMsg(obs.stream, metaSubj, opts...)
 	if err != nil {
 		if err == ErrMsgNotFound {
 			err = ErrObjectNotFound
@@ -834,12 +1832,10 @@ func (obs *obs) UpdateMeta(name string, meta *ObjectMeta) error {
 	info.Name = meta.Name
 	info.Description = meta.Description
 	info.Headers = meta.Headers
+	info.Expires = meta.Expires
 
 	// Prepare the meta message
-	metaSubj := fmt.Sprintf(objMetaPreTmpl, obs.name, encodeName(meta.Name))
-	mm := NewMsg(metaSubj)
-	mm.Header.Set(MsgRollup, MsgRollupSubject)
-	mm.Data, err = json.Marshal(info)
+	mm, err := obs.metaMsg(info)
 	if err != nil {
 		return err
 	}
@@ -853,13 +1849,36 @@ func (obs *obs) UpdateMeta(name string, meta *ObjectMeta) error {
 	// did the name of this object change? We just stored the meta under the new name
 	// so delete the meta from the old name via purge stream for subject
 	if name != meta.Name {
+		// The previous versions do not follow the object.
+		if obs.versioning != nil {
+			if err := obs.removeVersions(name, info.NUID); err != nil {
+				return err
+			}
+		}
 		metaSubj := fmt.Sprintf(objMetaPreTmpl, obs.name, encodeName(name))
 		return obs.js.purgeStream(obs.stream, &StreamPurgeRequest{Subject: metaSubj})
 	}
 
+	if obs.versioning != nil {
+		return obs.pruneVersions(name)
+	}
 	return nil
 }
 
+// metaMsg returns the message publishing the meta info. The previous meta
+// info is rolled up, except in versioned buckets.
+func (obs *obs) metaMsg(info *ObjectInfo) (*Msg, error) {
+	mm := NewMsg(fmt.Sprintf(objMetaPreTmpl, obs.name, encodeName(info.Name)))
+	if obs.versioning == nil {
+		mm.Header.Set(MsgRollup, MsgRollupSubject)
+	}
+	var err error
+	if mm.Data, err = json.Marshal(info); err != nil {
+		return nil, err
+	}
+	return mm, nil
+}
+
 // Seal will seal the object store, no further modifications will be allowed.
 func (obs *obs) Seal() error {
 	stream := fmt.Sprintf(objNameTmpl, obs.name)
@@ -874,10 +1893,94 @@ func (obs *obs) Seal() error {
 	return err
 }
 
-// Implementation for Watch
+// ObjectOp is the kind of change reported by an ObjectEvent.
+type ObjectOp uint8
+
+const (
+	// ObjectOpPut is reported when an object is put.
+	ObjectOpPut ObjectOp = iota
+	// ObjectOpUpdateMeta is reported when only the meta data of an object
+	// changed, including its name.
+	ObjectOpUpdateMeta
+	// ObjectOpDelete is reported when an object is deleted.
+	ObjectOpDelete
+	// ObjectOpLink is reported when a link is added.
+	ObjectOpLink
+)
+
+func (op ObjectOp) String() string {
+	switch op {
+	case ObjectOpPut:
+		return "ObjectPutOp"
+	case ObjectOpUpdateMeta:
+		return "ObjectUpdateMetaOp"
+	case ObjectOpDelete:
+		return "ObjectDeleteOp"
+	case ObjectOpLink:
+		return "ObjectLinkOp"
+	default:
+		return "Unknown Operation"
+	}
+}
+
+// ObjectEvent is a change of an object received from an ObjectEventWatcher.
+type ObjectEvent struct {
+	Op   ObjectOp
+	Info *ObjectInfo
+	// Sequence of the change in the stream, to be given to
+	// ResumeFromRevision() to resume watching after this change.
+	Sequence uint64
+
+	revStore RevisionStore
+}
+
+// CommitRevision records the sequence of the event in the store of the
+// watcher created with PersistRevision() that delivered it.
+func (ev *ObjectEvent) CommitRevision() error {
+	if ev.revStore == nil {
+		return ErrNoRevisionStore
+	}
+	return ev.revStore.StoreRevision(ev.Sequence)
+}
+
+// ObjectEventWatcher is what is returned when doing a WatchEvents.
+type ObjectEventWatcher interface {
+	// Events returns a channel to read the changes of the objects.
+	// A nil event is sent when all initial values have been received.
+	Events() <-chan *ObjectEvent
+	// Stop will stop this watcher.
+	Stop() error
+}
+
+// WatchNames instructs an object watcher to only report the objects whose
+// name matches one of the patterns, see path.Match for their syntax.
+// Object names are not part of the subjects in a form that can be filtered
+// by the server, so the watcher still receives the meta information of all
+// the objects and matches the names itself. WatchEvents tracks all the
+// objects, so an object renamed to a matching name is reported as a meta
+// update, while an object renamed to a name that does not match is not
+// reported at all.
+func WatchNames(patterns ...string) WatchOpt {
+	return watchOptFn(func(opts *watchOpts) error {
+		for _, p := range patterns {
+			if _, err := path.Match(p, _EMPTY_); err != nil {
+				return fmt.Errorf("nats: invalid name pattern %q: %v", p, err)
+			}
+		}
+		opts.namePatterns = append(opts.namePatterns, patterns...)
+		return nil
+	})
+}
+
+// Implementation for Watch and WatchEvents
 type objWatcher struct {
+	mu      sync.Mutex
 	updates chan *ObjectInfo
+	events  chan *ObjectEvent
 	sub     *Subscription
+	// To tell puts from meta updates.
+	lastNUID map[string]string
+	nuidName map[string]string
 }
 
 // Updates returns the interior channel.
@@ -888,7 +1991,16 @@ func (w *objWatcher) Updates() <-chan *ObjectInfo {
 	return w.updates
 }
 
-// Stop will unsubscribe from the watcher.
+// Events returns the interior channel.
+func (w *objWatcher) Events() <-chan *ObjectEvent {
+	if w == nil {
+		return nil
+	}
+	return w.events
+}
+
+// Stop will unsubscribe from the watcher, and close its channel once the
+// pending changes have been delivered.
 func (w *objWatcher) Stop() error {
 	if w == nil {
 		return nil
@@ -896,20 +2008,102 @@ func (w *objWatcher) Stop() error {
 	return w.sub.Unsubscribe()
 }
 
+// send delivers the event, nil for the initial values marker, to the channel
+// of the watcher.
+func (w *objWatcher) send(ev *ObjectEvent) {
+	if w.events != nil {
+		w.events <- ev
+	} else if ev == nil {
+		w.updates <- nil
+	} else {
+		w.updates <- ev.Info
+	}
+}
+
+// op returns the kind of change of the info, and tracks the objects.
+func (w *objWatcher) op(info *ObjectInfo) ObjectOp {
+	switch {
+	case info.Deleted:
+		delete(w.lastNUID, info.Name)
+		delete(w.nuidName, info.NUID)
+		return ObjectOpDelete
+	case info.isLink():
+		w.lastNUID[info.Name] = info.NUID
+		return ObjectOpLink
+	}
+	op := ObjectOpPut
+	if w.lastNUID[info.Name] == info.NUID {
+		op = ObjectOpUpdateMeta
+	} else if name, ok := w.nuidName[info.NUID]; ok && name != info.Name {
+		// Renamed.
+		delete(w.lastNUID, name)
+		op = ObjectOpUpdateMeta
+	}
+	w.lastNUID[info.Name] = info.NUID
+	w.nuidName[info.NUID] = info.Name
+	return op
+}
+
 // Watch for changes in the underlying store and receive meta information updates.
+// Use WatchEvents to persist the revisions with PersistRevision().
 func (obs *obs) Watch(opts ...WatchOpt) (ObjectWatcher, error) {
+	w := &objWatcher{updates: make(chan *ObjectInfo, 32)}
+	if err := obs.watch(w, opts); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// WatchEvents watches the changes of the objects, and reports their kind.
+// The first change seen for an object is reported as a put, unless it is a
+// delete or a link.
+func (obs *obs) WatchEvents(opts ...WatchOpt) (ObjectEventWatcher, error) {
+	w := &objWatcher{
+		events:   make(chan *ObjectEvent, 32),
+		lastNUID: make(map[string]string),
+		nuidName: make(map[string]string),
+	}
+	if err := obs.watch(w, opts); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (obs *obs) watch(w *objWatcher, opts []WatchOpt) error {
 	var o watchOpts
 	for _, opt := range opts {
 		if opt != nil {
 			if err := opt.configureWatcher(&o); err != nil {
-				return nil, err
+				return err
 			}
 		}
 	}
 
-	var initDoneMarker bool
+	// Only events can be committed.
+	if o.revStore != nil && w.events == nil {
+		return ErrObjectWatchRevision
+	}
+	// Figure out if we need to resume from a given sequence. Replacing
+	// objects purges chunks, so messages removed inside the stream are
+	// expected and not a sign of compaction.
+	start, err := resumeRevision(obs.js, obs.stream, &o)
+	if err != nil {
+		return err
+	}
 
-	w := &objWatcher{updates: make(chan *ObjectInfo, 32)}
+	matches := func(name string) bool {
+		if len(o.namePatterns) == 0 {
+			return true
+		}
+		for _, p := range o.namePatterns {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var initDoneMarker bool
 
 	update := func(m *Msg) {
 		var info ObjectInfo
@@ -921,35 +2115,61 @@ func (obs *obs) Watch(opts ...WatchOpt) (ObjectWatcher, error) {
 			return
 		}
 
-		if !o.ignoreDeletes || !info.Deleted {
-			info.ModTime = meta.Timestamp
-			w.updates <- &info
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		info.ModTime = meta.Timestamp
+		// Track all the objects, so that renames are seen.
+		var op ObjectOp
+		if w.events != nil {
+			op = w.op(&info)
+		}
+		if matches(info.Name) && (!o.ignoreDeletes || !info.Deleted) {
+			w.send(&ObjectEvent{Op: op, Info: &info, Sequence: meta.Sequence.Stream, revStore: o.revStore})
 		}
 
 		if !initDoneMarker && meta.NumPending == 0 {
 			initDoneMarker = true
-			w.updates <- nil
+			w.send(nil)
 		}
 	}
 
-	allMeta := fmt.Sprintf(objAllMetaPreTmpl, obs.name)
-	_, err := obs.js.GetLastMsg(obs.stream, allMeta)
-	if err == ErrMsgNotFound {
-		initDoneMarker = true
-		w.updates <- nil
-	}
-
 	// Used ordered consumer to deliver results.
+	allMeta := fmt.Sprintf(objAllMetaPreTmpl, obs.name)
 	subOpts := []SubOpt{OrderedConsumer()}
-	if !o.includeHistory {
+	if start > 0 {
+		subOpts = append(subOpts, StartSequence(start))
+	} else if !o.includeHistory {
 		subOpts = append(subOpts, DeliverLastPerSubject())
 	}
+	if o.ctx != nil {
+		subOpts = append(subOpts, Context(o.ctx))
+	}
+	// Create the sub under the lock to prevent the race between this code
+	// and the update() callback.
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	sub, err := obs.js.Subscribe(allMeta, update, subOpts...)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	sub.mu.Lock()
+	// If there were no pending messages at the time of the creation
+	// of the consumer, send the marker.
+	if sub.jsi != nil && sub.jsi.pending == 0 {
+		initDoneMarker = true
+		w.send(nil)
+	}
+	// Set us up to close when the waitForMessages func returns.
+	sub.pDone = func() {
+		if w.events != nil {
+			close(w.events)
+		} else {
+			close(w.updates)
+		}
 	}
+	sub.mu.Unlock()
 	w.sub = sub
-	return w, nil
+	return nil
 }
 
 // List will list all the objects in this store.
@@ -974,6 +2194,134 @@ func (obs *obs) List(opts ...WatchOpt) ([]*ObjectInfo, error) {
 	return objs, nil
 }
 
+// ListObjects lists a page of the objects in this store, in name order.
+// The names come from the subjects of the meta messages, and only the meta
+// information of the objects in the page is retrieved. When deleted objects
+// are excluded, the common prefixes only group objects that are not deleted.
+func (obs *obs) ListObjects(opts ...ListObjectsOpt) (*ObjectListing, error) {
+	var o listObjectsOpts
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.configureListObjects(&o); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var after string
+	if o.cursor != _EMPTY_ {
+		b, err := base64.URLEncoding.DecodeString(o.cursor)
+		if err != nil {
+			return nil, ErrBadListCursor
+		}
+		after = string(b)
+	}
+	names, err := obs.metaNames()
+	if err != nil {
+		return nil, err
+	}
+	return obs.listPage(names, &o, after)
+}
+
+// metaNames returns the names of the objects, from the subjects of the meta
+// messages, in order.
+func (obs *obs) metaNames() ([]string, error) {
+	counts, err := obs.subjectCounts(fmt.Sprintf(objAllMetaPreTmpl, obs.name))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(counts))
+	for ename := range counts {
+		b, err := base64.URLEncoding.DecodeString(ename)
+		if err != nil {
+			continue
+		}
+		names = append(names, string(b))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// listPage builds the page of the listing following after, from the sorted
+// names of the objects. The meta information is retrieved for the objects of
+// the page only, and for the objects of the common prefixes until one that
+// is not deleted is found, if deleted objects are excluded.
+func (obs *obs) listPage(names []string, o *listObjectsOpts, after string) (*ObjectListing, error) {
+	// A cursor ending with the delimiter is a common prefix, the objects it
+	// groups were listed already.
+	skipPrefix := o.delimiter != _EMPTY_ && strings.HasSuffix(after, o.delimiter)
+
+	// The names with the prefix are contiguous.
+	start := sort.SearchStrings(names, o.prefix)
+	if after > o.prefix {
+		start = sort.SearchStrings(names, after)
+	}
+
+	listing := &ObjectListing{}
+	var last string
+	full := func(next string) bool {
+		if o.limit > 0 && len(listing.Objects)+len(listing.CommonPrefixes) == o.limit {
+			listing.NextCursor = encodeName(last)
+			return true
+		}
+		last = next
+		return false
+	}
+	for i := start; i < len(names); i++ {
+		name := names[i]
+		if !strings.HasPrefix(name, o.prefix) {
+			break
+		}
+		if name <= after || (skipPrefix && strings.HasPrefix(name, after)) {
+			continue
+		}
+		if o.delimiter != _EMPTY_ {
+			if k := strings.Index(name[len(o.prefix):], o.delimiter); k >= 0 {
+				cp := name[:len(o.prefix)+k+len(o.delimiter)]
+				end := i + 1
+				for end < len(names) && strings.HasPrefix(names[end], cp) {
+					end++
+				}
+				live := !o.excludeDeleted
+				for j := i; j < end && !live; j++ {
+					info, err := obs.lastMeta(names[j], true)
+					if err == ErrObjectNotFound {
+						continue
+					}
+					if err != nil {
+						return nil, err
+					}
+					live = !info.Deleted
+				}
+				i = end - 1
+				if !live {
+					continue
+				}
+				if full(cp) {
+					break
+				}
+				listing.CommonPrefixes = append(listing.CommonPrefixes, cp)
+				continue
+			}
+		}
+		info, err := obs.lastMeta(name, true)
+		if err == ErrObjectNotFound {
+			// Removed since the names were gathered.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.Deleted && o.excludeDeleted {
+			continue
+		}
+		if full(name) {
+			break
+		}
+		listing.Objects = append(listing.Objects, info)
+	}
+	return listing, nil
+}
+
 // ObjectBucketStatus  represents status of a Bucket, implements ObjectStoreStatus
 type ObjectBucketStatus struct {
 	nfo    *StreamInfo
@@ -1038,15 +2386,30 @@ func (o *objResult) Read(p []byte) (n int, err error) {
 		}
 	}
 	if o.err != nil {
-		return 0, err
+		return 0, o.err
+	}
+	if o.closed {
+		return 0, io.ErrClosedPipe
 	}
 	if o.r == nil {
-		return 0, io.EOF
+		if o.pos >= o.limit {
+			return 0, io.EOF
+		}
+		if err := o.fetch(); err != nil {
+			return 0, err
+		}
 	}
 
-	r := o.r.(net.Conn)
+	r := o.r
 	r.SetReadDeadline(time.Now().Add(2 * time.Second))
 	n, err = r.Read(p)
+	o.pos += int64(n)
+	if err != nil {
+		if ferr := o.ferr.get(); ferr != nil {
+			o.err = ferr
+			return n, o.err
+		}
+	}
 	if err, ok := err.(net.Error); ok && err.Timeout() {
 		if ctx := o.ctx; ctx != nil {
 			select {
@@ -1061,7 +2424,7 @@ func (o *objResult) Read(p []byte) (n int, err error) {
 			}
 		}
 	}
-	if err == io.EOF {
+	if err == io.EOF && o.digest != nil {
 		// Make sure the digest matches.
 		sha := o.digest.Sum(nil)
 		digest := strings.SplitN(o.info.Digest, "=", 2)
@@ -1082,20 +2445,69 @@ func (o *objResult) Read(p []byte) (n int, err error) {
 	return n, err
 }
 
-// Close impl.
-func (o *objResult) Close() error {
+// Seek impl. Seeking only fetches the chunks needed from the new position,
+// and the digest is then only verified when reading again from the start.
+func (o *objResult) Seek(offset int64, whence int) (int64, error) {
 	o.Lock()
 	defer o.Unlock()
-	if o.r == nil {
-		return nil
+	if o.closed {
+		return 0, io.ErrClosedPipe
+	}
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = o.pos + offset
+	case io.SeekEnd:
+		pos = o.limit + offset
+	default:
+		return 0, errors.New("nats: invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("nats: negative position")
+	}
+	if pos != o.pos {
+		o.stop()
+		o.pos = pos
+	}
+	return pos, nil
+}
+
+// ReadAt impl. It does not change the current position of the result.
+func (o *objResult) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("nats: negative offset")
+	}
+	o.Lock()
+	base, limit, err := o.base, o.limit, o.err
+	o.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if off >= limit {
+		return 0, io.EOF
+	}
+	n := int64(len(p))
+	if off+n > limit {
+		n = limit - off
 	}
-	return o.r.Close()
+	r := &objResult{obs: o.obs, info: o.info, ctx: o.ctx, base: base + off, limit: n}
+	defer r.Close()
+	read, err := io.ReadFull(r, p[:n])
+	if err == nil && n < int64(len(p)) {
+		err = io.EOF
+	}
+	return read, err
 }
 
-func (o *objResult) setErr(err error) {
+// Close impl.
+func (o *objResult) Close() error {
 	o.Lock()
 	defer o.Unlock()
-	o.err = err
+	o.closed = true
+	o.stop()
+	return nil
 }
 
 func (o *objResult) Info() (*ObjectInfo, error) {
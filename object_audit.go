@@ -0,0 +1,285 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AuditOpt is used to configure Audit.
+type AuditOpt interface {
+	configureAudit(opts *auditOpts) error
+}
+
+type auditOpts struct {
+	verifyData  bool
+	purge       bool
+	purgeMinAge time.Duration
+}
+
+type auditOptFn func(opts *auditOpts) error
+
+func (opt auditOptFn) configureAudit(opts *auditOpts) error {
+	return opt(opts)
+}
+
+// AuditVerifyData instructs Audit to read the chunks of the objects to verify
+// their size and digest. This reads all the data of the bucket.
+func AuditVerifyData() AuditOpt {
+	return auditOptFn(func(opts *auditOpts) error {
+		opts.verifyData = true
+		return nil
+	})
+}
+
+// AuditPurgeOrphans instructs Audit to purge the orphaned chunks whose last
+// chunk is older than minAge. The age protects the uploads in progress, and
+// the interrupted resumable uploads that could still be resumed.
+func AuditPurgeOrphans(minAge time.Duration) AuditOpt {
+	return auditOptFn(func(opts *auditOpts) error {
+		if minAge < 0 {
+			return errors.New("nats: orphans minimum age should be >= 0")
+		}
+		opts.purge = true
+		opts.purgeMinAge = minAge
+		return nil
+	})
+}
+
+// ObjectAuditReport is the result of auditing an object store.
+type ObjectAuditReport struct {
+	// Objects is the number of object versions checked.
+	Objects int
+	// Orphans are the chunks not referenced by any object.
+	Orphans []*ObjectOrphan
+	// Issues are the problems found with the objects.
+	Issues []*ObjectAuditIssue
+}
+
+// ObjectOrphan is a set of chunks not referenced by any object, for instance
+// left by an upload that did not complete.
+type ObjectOrphan struct {
+	NUID      string
+	Chunks    uint64
+	LastChunk time.Time
+	Purged    bool
+}
+
+// ObjectAuditIssueKind is the kind of problem found by Audit.
+type ObjectAuditIssueKind int
+
+const (
+	// ObjectMissingChunks is reported when there are less chunks than the
+	// object should have.
+	ObjectMissingChunks ObjectAuditIssueKind = iota
+	// ObjectExtraChunks is reported when there are more chunks than the
+	// object should have.
+	ObjectExtraChunks
+	// ObjectSizeMismatch is reported when the size of the data is not the
+	// size of the object.
+	ObjectSizeMismatch
+	// ObjectDigestMismatch is reported when the digest of the data is not
+	// the digest of the object.
+	ObjectDigestMismatch
+	// ObjectUnreadable is reported when a chunk could not be read or decoded.
+	ObjectUnreadable
+)
+
+func (k ObjectAuditIssueKind) String() string {
+	switch k {
+	case ObjectMissingChunks:
+		return "MissingChunks"
+	case ObjectExtraChunks:
+		return "ExtraChunks"
+	case ObjectSizeMismatch:
+		return "SizeMismatch"
+	case ObjectDigestMismatch:
+		return "DigestMismatch"
+	case ObjectUnreadable:
+		return "Unreadable"
+	default:
+		return "Unknown"
+	}
+}
+
+// ObjectAuditIssue is a problem found with an object.
+type ObjectAuditIssue struct {
+	Name   string
+	NUID   string
+	Kind   ObjectAuditIssueKind
+	Detail string
+}
+
+// Audit walks the meta information and the chunks of the bucket, and reports
+// the orphaned chunks and the problems found with the objects. It does not
+// modify the bucket, unless AuditPurgeOrphans is used.
+func (obs *obs) Audit(opts ...AuditOpt) (*ObjectAuditReport, error) {
+	var o auditOpts
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.configureAudit(&o); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Number of chunks per NUID.
+	chunks, err := obs.subjectCounts(fmt.Sprintf(objAllChunksPreTmpl, obs.name))
+	if err != nil {
+		return nil, err
+	}
+	metas, err := obs.subjectCounts(fmt.Sprintf(objAllMetaPreTmpl, obs.name))
+	if err != nil {
+		return nil, err
+	}
+	// The objects are audited in name order. Names are decoded for the
+	// report only, the chunks of objects whose name can not be decoded are
+	// still referenced, since anything not referenced may be purged.
+	type metaName struct{ name, subj string }
+	names := make([]metaName, 0, len(metas))
+	for ename := range metas {
+		name := ename
+		if b, err := base64.URLEncoding.DecodeString(ename); err == nil {
+			name = string(b)
+		}
+		names = append(names, metaName{name, fmt.Sprintf(objMetaPreTmpl, obs.name, ename)})
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].name < names[j].name })
+
+	report := &ObjectAuditReport{}
+	referenced := make(map[string]struct{})
+	for _, mn := range names {
+		vs, err := obs.metaVersions(mn.subj)
+		if err == ErrObjectNotFound {
+			// Removed since the subjects were gathered.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vs {
+			info := v.info
+			if info.Deleted {
+				continue
+			}
+			report.Objects++
+			if _, ok := referenced[info.NUID]; ok {
+				continue
+			}
+			referenced[info.NUID] = struct{}{}
+			issues, err := obs.auditObject(info, chunks[info.NUID], o.verifyData)
+			if err != nil {
+				return nil, err
+			}
+			report.Issues = append(report.Issues, issues...)
+		}
+	}
+
+	nuids := make([]string, 0, len(chunks))
+	for nuid := range chunks {
+		if _, ok := referenced[nuid]; !ok {
+			nuids = append(nuids, nuid)
+		}
+	}
+	sort.Strings(nuids)
+	for _, nuid := range nuids {
+		chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, nuid)
+		orphan := &ObjectOrphan{NUID: nuid, Chunks: chunks[nuid]}
+		m, err := obs.js.GetLastMsg(obs.stream, chunkSubj)
+		if err != nil && err != ErrMsgNotFound {
+			return nil, err
+		}
+		if m != nil {
+			orphan.LastChunk = m.Time
+		}
+		if o.purge && time.Since(orphan.LastChunk) >= o.purgeMinAge {
+			if err := obs.js.purgeStream(obs.stream, &StreamPurgeRequest{Subject: chunkSubj}); err != nil {
+				return nil, err
+			}
+			orphan.Purged = true
+		}
+		report.Orphans = append(report.Orphans, orphan)
+	}
+	return report, nil
+}
+
+// subjectCounts returns the number of messages of the subjects matching the
+// filter, by their last token.
+func (obs *obs) subjectCounts(filter string) (map[string]uint64, error) {
+	si, err := obs.js.StreamInfo(obs.stream, &StreamInfoRequest{SubjectsFilter: filter})
+	if err != nil {
+		return nil, err
+	}
+	pre := filter[:len(filter)-1]
+	counts := make(map[string]uint64, len(si.State.Subjects))
+	for subj, n := range si.State.Subjects {
+		counts[strings.TrimPrefix(subj, pre)] = n
+	}
+	return counts, nil
+}
+
+// auditObject checks the chunks of an object. An error is returned if the
+// chunks could not be read, problems with their content are issues.
+func (obs *obs) auditObject(info *ObjectInfo, stored uint64, verifyData bool) ([]*ObjectAuditIssue, error) {
+	var issues []*ObjectAuditIssue
+	issue := func(kind ObjectAuditIssueKind, format string, args ...interface{}) {
+		issues = append(issues, &ObjectAuditIssue{Name: info.Name, NUID: info.NUID, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+	switch {
+	case stored < uint64(info.Chunks):
+		issue(ObjectMissingChunks, "%d chunks stored, expected %d", stored, info.Chunks)
+	case stored > uint64(info.Chunks):
+		issue(ObjectExtraChunks, "%d chunks stored, expected %d", stored, info.Chunks)
+	}
+	if !verifyData || info.isLink() {
+		return issues, nil
+	}
+
+	chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, info.NUID)
+	h, size, unreadable := sha256.New(), uint64(0), false
+	err := obs.readMsgs(chunkSubj, func(m *Msg, meta *MsgMetadata) error {
+		if unreadable {
+			return nil
+		}
+		data, err := decodeValue(obs.transforms, m.Subject, info.chunkSize(), m.Header, m.Data)
+		if err != nil {
+			issue(ObjectUnreadable, "chunk %d: %v", meta.Sequence.Stream, err)
+			unreadable = true
+			return nil
+		}
+		h.Write(data)
+		size += uint64(len(data))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unreadable {
+		return issues, nil
+	}
+	if size != info.Size {
+		issue(ObjectSizeMismatch, "%d bytes stored, expected %d", size, info.Size)
+	}
+	sha := h.Sum(nil)
+	if digest := fmt.Sprintf(objDigestTmpl, base64.URLEncoding.EncodeToString(sha)); digest != info.Digest {
+		issue(ObjectDigestMismatch, "digest is %s, expected %s", digest, info.Digest)
+	}
+	return issues, nil
+}
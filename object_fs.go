@@ -0,0 +1,358 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ObjectFS exposes an ObjectStore as a read only file system.
+//
+// Object names are treated as slash separated paths, and the intermediate
+// elements of those paths as directories. Links to other objects are
+// followed, links to buckets are not listed. The FileInfo returned for an
+// object has the *ObjectInfo of the object, or of the linked object, as Sys().
+//
+// Notice: Experimental Preview
+//
+// This functionality is EXPERIMENTAL and may be changed in later releases.
+type ObjectFS interface {
+	fs.ReadDirFS
+	fs.StatFS
+}
+
+// NewObjectFS returns an ObjectFS reading from the object store.
+func NewObjectFS(store ObjectStore) (ObjectFS, error) {
+	ob, ok := store.(*obs)
+	if !ok {
+		return nil, errors.New("nats: object-store malformed")
+	}
+	return &objFS{obs: ob}, nil
+}
+
+// NewObjectFileSystem returns an http.FileSystem serving the objects of the
+// object store, see ObjectFS.
+func NewObjectFileSystem(store ObjectStore) (http.FileSystem, error) {
+	fsys, err := NewObjectFS(store)
+	if err != nil {
+		return nil, err
+	}
+	return http.FS(fsys), nil
+}
+
+// NewObjectFileServer returns a handler serving HTTP requests with the objects
+// of the object store, like http.FileServer. The digest of the objects is used
+// as their ETag, so that conditional requests can be answered without reading
+// the objects.
+func NewObjectFileServer(store ObjectStore) (http.Handler, error) {
+	fsys, err := NewObjectFS(store)
+	if err != nil {
+		return nil, err
+	}
+	fileServer := http.FileServer(http.FS(fsys))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == _EMPTY_ {
+			name = "."
+		}
+		if fi, err := fsys.Stat(name); err == nil && !fi.IsDir() {
+			if info, ok := fi.Sys().(*ObjectInfo); ok && info.Digest != _EMPTY_ {
+				w.Header().Set("Etag", `"`+info.Digest+`"`)
+			}
+		}
+		fileServer.ServeHTTP(w, r)
+	}), nil
+}
+
+// Maximum number of links followed to find an object.
+const objMaxLinkDepth = 8
+
+// Implementation for ObjectFS
+type objFS struct {
+	obs *obs
+}
+
+// Open opens the object or directory with the given name.
+func (ofs *objFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	oname, info, err := ofs.objectInfo(name)
+	if err != nil && err != ErrObjectNotFound {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if info != nil {
+		result, err := ofs.obs.Get(oname)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &objFile{ObjectResult: result, fi: &objFileInfo{name: path.Base(name), info: info}}, nil
+	}
+	entries, err := ofs.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &objDir{fi: &objFileInfo{name: path.Base(name)}, entries: entries}, nil
+}
+
+// Stat returns the FileInfo of the object or directory with the given name.
+func (ofs *objFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	_, info, err := ofs.objectInfo(name)
+	if err != nil && err != ErrObjectNotFound {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	if info != nil {
+		return &objFileInfo{name: path.Base(name), info: info}, nil
+	}
+	if ok, err := ofs.isDir(name); err != nil || !ok {
+		if err == nil {
+			err = fs.ErrNotExist
+		}
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return &objFileInfo{name: path.Base(name)}, nil
+}
+
+// ReadDir reads the directory with the given name, sorted by file name.
+func (ofs *objFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, err := ofs.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+// objectInfo returns the name and the info of the object at this path,
+// following links. Object names may start with a slash. Directories have no
+// info and ErrObjectNotFound is returned for them.
+func (ofs *objFS) objectInfo(name string) (string, *ObjectInfo, error) {
+	if name == "." {
+		return _EMPTY_, nil, ErrObjectNotFound
+	}
+	info, err := getLiveInfo(ofs.obs, name)
+	if err == ErrObjectNotFound {
+		name = "/" + name
+		info, err = getLiveInfo(ofs.obs, name)
+	}
+	if err != nil {
+		return _EMPTY_, nil, err
+	}
+	info, err = ofs.resolve(info)
+	return name, info, err
+}
+
+// resolve follows the links to objects.
+func (ofs *objFS) resolve(info *ObjectInfo) (*ObjectInfo, error) {
+	store := ofs.obs
+	for depth := 0; info.isLink(); depth++ {
+		link := info.Opts.Link
+		if link.Name == _EMPTY_ || depth == objMaxLinkDepth {
+			return nil, ErrObjectNotFound
+		}
+		if link.Bucket != store.name {
+			lobs, err := store.js.ObjectStore(link.Bucket)
+			if err != nil {
+				return nil, err
+			}
+			store = lobs.(*obs)
+		}
+		var err error
+		if info, err = getLiveInfo(store, link.Name); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// getLiveInfo is like GetInfo but deleted objects are not found.
+func getLiveInfo(store *obs, name string) (*ObjectInfo, error) {
+	info, err := store.GetInfo(name)
+	if err == nil && info.Deleted {
+		return nil, ErrObjectNotFound
+	}
+	return info, err
+}
+
+// readDir lists the objects and returns the entries of the directory name.
+// fs.ErrNotExist is returned if no object is under that directory, except
+// for the root.
+func (ofs *objFS) readDir(name string) ([]fs.DirEntry, error) {
+	prefix := _EMPTY_
+	if name != "." {
+		prefix = name + "/"
+	}
+	names, err := ofs.obs.metaNames()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	var entries []fs.DirEntry
+	// Object names may start with a slash, so the names are listed once for
+	// both forms of the prefix.
+	for _, lprefix := range []string{prefix, "/" + prefix} {
+		listing, err := ofs.listDir(names, lprefix, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, cp := range listing.CommonPrefixes {
+			// An object in a sub directory.
+			dir := strings.TrimSuffix(cp[len(lprefix):], "/")
+			if _, ok := seen[dir]; !ok && dir != _EMPTY_ {
+				seen[dir] = struct{}{}
+				entries = append(entries, &objFileInfo{name: dir})
+			}
+		}
+		for _, info := range listing.Objects {
+			rest := info.Name[len(lprefix):]
+			if rest == _EMPTY_ {
+				continue
+			}
+			if info.isLink() {
+				var err error
+				if info, err = ofs.resolve(info); err != nil {
+					continue
+				}
+			}
+			entries = append(entries, &objFileInfo{name: rest, info: info})
+		}
+	}
+	if len(entries) == 0 && prefix != _EMPTY_ {
+		return nil, fs.ErrNotExist
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// isDir returns true if there are live objects under the directory.
+func (ofs *objFS) isDir(name string) (bool, error) {
+	if name == "." {
+		return true, nil
+	}
+	names, err := ofs.obs.metaNames()
+	if err != nil {
+		return false, err
+	}
+	for _, prefix := range []string{name + "/", "/" + name + "/"} {
+		listing, err := ofs.listDir(names, prefix, 1)
+		if err != nil {
+			return false, err
+		}
+		if len(listing.Objects)+len(listing.CommonPrefixes) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// listDir lists the live objects and the sub directories under prefix, from
+// the names of the objects, up to limit entries if set.
+func (ofs *objFS) listDir(names []string, prefix string, limit int) (*ObjectListing, error) {
+	o := &listObjectsOpts{prefix: prefix, delimiter: "/", limit: limit, excludeDeleted: true}
+	return ofs.obs.listPage(names, o, _EMPTY_)
+}
+
+// objFileInfo is the FileInfo and DirEntry of an object, or of a directory
+// when info is nil.
+type objFileInfo struct {
+	name string
+	info *ObjectInfo
+}
+
+func (fi *objFileInfo) Name() string { return fi.name }
+func (fi *objFileInfo) IsDir() bool  { return fi.info == nil }
+
+func (fi *objFileInfo) Size() int64 {
+	if fi.info == nil {
+		return 0
+	}
+	return int64(fi.info.Size)
+}
+
+func (fi *objFileInfo) Mode() fs.FileMode {
+	if fi.info == nil {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (fi *objFileInfo) ModTime() time.Time {
+	if fi.info == nil {
+		return time.Time{}
+	}
+	return fi.info.ModTime
+}
+
+// Sys returns the *ObjectInfo of objects, nil for directories.
+func (fi *objFileInfo) Sys() interface{} {
+	if fi.info == nil {
+		return nil
+	}
+	return fi.info
+}
+
+func (fi *objFileInfo) Type() fs.FileMode          { return fi.Mode().Type() }
+func (fi *objFileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+// objFile is an object opened from an ObjectFS.
+type objFile struct {
+	ObjectResult
+	fi *objFileInfo
+}
+
+func (f *objFile) Stat() (fs.FileInfo, error) { return f.fi, nil }
+
+// objDir is a directory opened from an ObjectFS.
+type objDir struct {
+	fi      *objFileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *objDir) Stat() (fs.FileInfo, error) { return d.fi, nil }
+func (d *objDir) Close() error               { return nil }
+
+func (d *objDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.fi.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries of the directory, or all the remaining
+// ones if n <= 0.
+func (d *objDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ObjectRetentionRule limits the objects kept in an object store, see Reap.
+type ObjectRetentionRule struct {
+	// Prefix of the names of the objects the rule applies to, all the
+	// objects if empty.
+	Prefix string
+	// KeepLast is the number of most recently modified objects kept, no
+	// limit if 0.
+	KeepLast int
+	// MaxAge is how long objects are kept after their last modification,
+	// no limit if 0.
+	MaxAge time.Duration
+}
+
+// ObjectReaper is returned by StartReaper.
+type ObjectReaper interface {
+	// Stop stops the reaper.
+	Stop()
+}
+
+// Reap deletes the expired objects and the objects beyond the retention rules.
+// Objects are deleted like with Delete, the meta information first and then
+// the chunks.
+func (obs *obs) Reap(rules ...*ObjectRetentionRule) ([]*ObjectInfo, error) {
+	for _, rule := range rules {
+		if rule == nil || rule.KeepLast < 0 || rule.MaxAge < 0 {
+			return nil, errors.New("nats: invalid retention rule")
+		}
+	}
+	infos, err := obs.List()
+	if err == ErrNoObjectsFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := obs.js.nc.Opts.clock().Now()
+	reap := make(map[string]*ObjectInfo)
+	for _, info := range infos {
+		if info.Expires != nil && !now.Before(*info.Expires) {
+			reap[info.Name] = info
+		}
+	}
+	for _, rule := range rules {
+		var matched []*ObjectInfo
+		for _, info := range infos {
+			if strings.HasPrefix(info.Name, rule.Prefix) {
+				matched = append(matched, info)
+			}
+		}
+		// Most recent first.
+		sort.Slice(matched, func(i, j int) bool { return matched[i].ModTime.After(matched[j].ModTime) })
+		for i, info := range matched {
+			if (rule.KeepLast > 0 && i >= rule.KeepLast) || (rule.MaxAge > 0 && now.Sub(info.ModTime) > rule.MaxAge) {
+				reap[info.Name] = info
+			}
+		}
+	}
+
+	names := make([]string, 0, len(reap))
+	for name := range reap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	deleted := make([]*ObjectInfo, 0, len(names))
+	for _, name := range names {
+		// Skip objects replaced since they were listed.
+		listed := reap[name]
+		info, err := obs.GetInfo(name)
+		if err == ErrObjectNotFound {
+			continue
+		}
+		if err != nil {
+			return deleted, err
+		}
+		if info.Deleted || info.NUID != listed.NUID || !info.ModTime.Equal(listed.ModTime) {
+			continue
+		}
+		if err := obs.Delete(name); err != nil {
+			if err == ErrObjectNotFound {
+				continue
+			}
+			return deleted, err
+		}
+		deleted = append(deleted, reap[name])
+	}
+	return deleted, nil
+}
+
+// StartReaper runs Reap at the interval until the reaper is stopped. Errors
+// are reported to the asynchronous error handler of the connection. The
+// interval and the expiry of the objects are measured with the Clock of the
+// connection.
+func (obs *obs) StartReaper(interval time.Duration, rules ...*ObjectRetentionRule) (ObjectReaper, error) {
+	if interval <= 0 {
+		return nil, errors.New("nats: reaper interval should be > 0")
+	}
+	r := &objReaper{quit: make(chan struct{})}
+	t := obs.js.nc.Opts.clock().NewTimer(interval)
+	go func() {
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C():
+				if _, err := obs.Reap(rules...); err != nil {
+					obs.asyncErr(err)
+				}
+				t.Reset(interval)
+			case <-r.quit:
+				return
+			}
+		}
+	}()
+	return r, nil
+}
+
+// Implementation for ObjectReaper
+type objReaper struct {
+	quit chan struct{}
+	once sync.Once
+}
+
+// Stop stops the reaper.
+func (r *objReaper) Stop() {
+	r.once.Do(func() { close(r.quit) })
+}
+
+// asyncErr reports an error to the asynchronous error handler.
+func (obs *obs) asyncErr(err error) {
+	nc := obs.js.nc
+	nc.mu.Lock()
+	nc.pushAsyncErr(nil, err)
+	nc.mu.Unlock()
+}
@@ -0,0 +1,440 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SyncOpt is used to configure the synchronization of an object store with
+// a directory or a tar archive.
+type SyncOpt interface {
+	configureSync(opts *syncOpts) error
+}
+
+type syncOpts struct {
+	prefix string
+	delete bool
+}
+
+type syncOptFn func(opts *syncOpts) error
+
+func (opt syncOptFn) configureSync(opts *syncOpts) error {
+	return opt(opts)
+}
+
+// SyncPrefix only synchronizes the objects whose name starts with prefix.
+// The prefix is removed from the object names to get the file names, and
+// added to the file names to get the object names.
+func SyncPrefix(prefix string) SyncOpt {
+	return syncOptFn(func(opts *syncOpts) error {
+		opts.prefix = prefix
+		return nil
+	})
+}
+
+// SyncDelete deletes the entries of the destination that are not in the source.
+func SyncDelete() SyncOpt {
+	return syncOptFn(func(opts *syncOpts) error {
+		opts.delete = true
+		return nil
+	})
+}
+
+// ObjectSyncReport is the result of a synchronization. Entries are object names.
+type ObjectSyncReport struct {
+	// Transferred are the objects uploaded, downloaded or imported.
+	Transferred []string
+	// Unchanged are the objects skipped because they were identical.
+	Unchanged []string
+	// Deleted are the objects, or the files of the objects, deleted.
+	Deleted []string
+	// Skipped are the objects not downloaded because their name can not be
+	// used as a file name inside the directory.
+	Skipped []string
+}
+
+// PAX records used to store the meta information of objects in tar archives.
+const (
+	objTarDescription = "NATS.description"
+	objTarHeaders     = "NATS.headers"
+	objTarDigest      = "NATS.digest"
+)
+
+func getSyncOpts(opts []SyncOpt) (*syncOpts, error) {
+	var o syncOpts
+	for _, opt := range opts {
+		if opt != nil {
+			if err := opt.configureSync(&o); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &o, nil
+}
+
+// fileDigest returns the digest of a file, in the format of ObjectInfo.Digest.
+func fileDigest(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return _EMPTY_, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return _EMPTY_, err
+	}
+	return fmt.Sprintf(objDigestTmpl, base64.URLEncoding.EncodeToString(h.Sum(nil))), nil
+}
+
+// listSynced returns the objects with the prefix, by name, excluding links
+// to buckets.
+func (obs *obs) listSynced(prefix string) (map[string]*ObjectInfo, error) {
+	objects := make(map[string]*ObjectInfo)
+	infos, err := obs.List()
+	if err != nil && err != ErrNoObjectsFound {
+		return nil, err
+	}
+	for _, info := range infos {
+		if !strings.HasPrefix(info.Name, prefix) || (info.isLink() && info.Opts.Link.Name == _EMPTY_) {
+			continue
+		}
+		objects[info.Name] = info
+	}
+	return objects, nil
+}
+
+// deleteExtraneous deletes the objects not synchronized.
+func (obs *obs) deleteExtraneous(objects map[string]*ObjectInfo, synced map[string]struct{}, report *ObjectSyncReport) error {
+	for name := range objects {
+		if _, ok := synced[name]; ok {
+			continue
+		}
+		if err := obs.Delete(name); err != nil && err != ErrObjectNotFound {
+			return err
+		}
+		report.Deleted = append(report.Deleted, name)
+	}
+	sort.Strings(report.Deleted)
+	return nil
+}
+
+// UploadDir uploads the regular files of the directory tree as objects named
+// after their slash separated path. Files whose content is identical to the
+// object are skipped. The description, headers, expiration and chunk size
+// of replaced objects are kept.
+func (obs *obs) UploadDir(dir string, opts ...SyncOpt) (*ObjectSyncReport, error) {
+	o, err := getSyncOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := obs.listSynced(o.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ObjectSyncReport{}
+	synced := make(map[string]struct{})
+	err = filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		name := o.prefix + filepath.ToSlash(rel)
+		synced[name] = struct{}{}
+
+		meta := &ObjectMeta{Name: name}
+		if info := objects[name]; info != nil {
+			if !info.isLink() {
+				digest, err := fileDigest(file)
+				if err != nil {
+					return err
+				}
+				if digest == info.Digest {
+					report.Unchanged = append(report.Unchanged, name)
+					return nil
+				}
+			}
+			meta.Description, meta.Headers, meta.Expires = info.Description, info.Headers, info.Expires
+			if info.Opts != nil && info.Opts.ChunkSize > 0 {
+				meta.Opts = &ObjectMetaOptions{ChunkSize: info.Opts.ChunkSize}
+			}
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := obs.Put(meta, f); err != nil {
+			return err
+		}
+		report.Transferred = append(report.Transferred, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if o.delete {
+		if err := obs.deleteExtraneous(objects, synced, report); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// DownloadDir downloads the objects into files of the directory, named after
+// the object names. Files whose content is identical to the object are
+// skipped. Objects whose name would be outside of the directory, or that
+// start with a slash, are not downloaded and reported as skipped.
+func (obs *obs) DownloadDir(dir string, opts ...SyncOpt) (*ObjectSyncReport, error) {
+	o, err := getSyncOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := obs.listSynced(o.prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &ObjectSyncReport{}
+	files := make(map[string]string)
+	for _, name := range names {
+		rel := path.Clean(strings.TrimPrefix(name, o.prefix))
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			report.Skipped = append(report.Skipped, name)
+			continue
+		}
+		file := filepath.Join(dir, filepath.FromSlash(rel))
+		files[file] = name
+
+		info := objects[name]
+		if !info.isLink() {
+			if digest, err := fileDigest(file); err == nil && digest == info.Digest {
+				report.Unchanged = append(report.Unchanged, name)
+				continue
+			}
+		}
+		if err := obs.downloadFile(name, file); err != nil {
+			return nil, err
+		}
+		report.Transferred = append(report.Transferred, name)
+	}
+
+	if o.delete {
+		err = filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			if _, ok := files[file]; ok {
+				return nil
+			}
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, file)
+			report.Deleted = append(report.Deleted, o.prefix+filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// downloadFile writes the object to a temporary file renamed to file once
+// complete, so that a failure does not leave a partial file.
+func (obs *obs) downloadFile(name, file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	result, err := obs.Get(name)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+
+	f, err := ioutil.TempFile(filepath.Dir(file), ".nats-obj-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, result)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// ExportTar writes the objects as a tar archive. The description, headers
+// and digest of the objects are stored as PAX records.
+func (obs *obs) ExportTar(w io.Writer, opts ...SyncOpt) error {
+	o, err := getSyncOpts(opts)
+	if err != nil {
+		return err
+	}
+	objects, err := obs.listSynced(o.prefix)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(objects))
+	for name := range objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		result, err := obs.Get(name)
+		if err != nil {
+			return err
+		}
+		info, err := result.Info()
+		if err != nil {
+			result.Close()
+			return err
+		}
+		hdr := &tar.Header{
+			Typeflag:   tar.TypeReg,
+			Name:       strings.TrimPrefix(name, o.prefix),
+			Size:       int64(info.Size),
+			Mode:       0644,
+			ModTime:    objects[name].ModTime,
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{objTarDigest: info.Digest},
+		}
+		if d := objects[name].Description; d != _EMPTY_ {
+			hdr.PAXRecords[objTarDescription] = d
+		}
+		if h := objects[name].Headers; len(h) > 0 {
+			b, err := json.Marshal(h)
+			if err != nil {
+				result.Close()
+				return err
+			}
+			hdr.PAXRecords[objTarHeaders] = string(b)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			result.Close()
+			return err
+		}
+		_, err = io.Copy(tw, result)
+		result.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// ImportTar places the regular files of the tar archive into objects. The
+// description and headers stored by ExportTar are restored. Files whose
+// content does not match the digest stored by ExportTar are not stored,
+// and ErrDigestMismatch is returned.
+func (obs *obs) ImportTar(r io.Reader, opts ...SyncOpt) (*ObjectSyncReport, error) {
+	o, err := getSyncOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	var objects map[string]*ObjectInfo
+	if o.delete {
+		if objects, err = obs.listSynced(o.prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &ObjectSyncReport{}
+	synced := make(map[string]struct{})
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		meta := &ObjectMeta{
+			Name:        o.prefix + strings.TrimPrefix(hdr.Name, "./"),
+			Description: hdr.PAXRecords[objTarDescription],
+		}
+		if h := hdr.PAXRecords[objTarHeaders]; h != _EMPTY_ {
+			if err := json.Unmarshal([]byte(h), &meta.Headers); err != nil {
+				return nil, err
+			}
+		}
+		var fr io.Reader = tr
+		if digest := hdr.PAXRecords[objTarDigest]; digest != _EMPTY_ {
+			// Fails the upload before the meta info is published.
+			fr = &digestReader{r: tr, h: sha256.New(), digest: digest}
+		}
+		if _, err := obs.Put(meta, fr); err != nil {
+			return nil, err
+		}
+		synced[meta.Name] = struct{}{}
+		report.Transferred = append(report.Transferred, meta.Name)
+	}
+	if o.delete {
+		if err := obs.deleteExtraneous(objects, synced, report); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// digestReader returns ErrDigestMismatch instead of io.EOF if the data read
+// does not have the digest.
+type digestReader struct {
+	r      io.Reader
+	h      hash.Hash
+	digest string
+}
+
+func (dr *digestReader) Read(p []byte) (int, error) {
+	n, err := dr.r.Read(p)
+	dr.h.Write(p[:n])
+	if err == io.EOF && fmt.Sprintf(objDigestTmpl, base64.URLEncoding.EncodeToString(dr.h.Sum(nil))) != dr.digest {
+		return n, ErrDigestMismatch
+	}
+	return n, err
+}
@@ -0,0 +1,446 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProtoTrace is a protocol operation exchanged with the server.
+type ProtoTrace struct {
+	// Time the operation was sent or received.
+	Time time.Time
+	// Outbound is true for the operations sent by the client.
+	Outbound bool
+	// Op is the control line of the operation, without the CRLF. The
+	// credentials of CONNECT are redacted.
+	Op string
+	// Payload of PUB, HPUB, MSG and HMSG, truncated to the maximum set with
+	// the TraceProtocol() option.
+	Payload []byte
+	// Size is the size of the whole payload, headers included.
+	Size int
+}
+
+// String returns the operation in the format of the server traces.
+func (t *ProtoTrace) String() string {
+	dir := "<<-"
+	if t.Outbound {
+		dir = "->>"
+	}
+	if t.Size == 0 && len(t.Payload) == 0 {
+		return fmt.Sprintf("%s [%s]", dir, t.Op)
+	}
+	if len(t.Payload) < t.Size {
+		return fmt.Sprintf("%s [%s] %q...", dir, t.Op, t.Payload)
+	}
+	return fmt.Sprintf("%s [%s] %q", dir, t.Op, t.Payload)
+}
+
+// ProtoTraceHandler is used to trace the protocol operations of a
+// connection. It is called synchronously from the read loop or with the
+// connection lock held, so it must not block nor call the connection.
+type ProtoTraceHandler func(trace *ProtoTrace)
+
+// TraceProtocol is an Option to trace the protocol operations exchanged with
+// the server, with up to maxPayload bytes of their payload. If cb is nil, the
+// operations are printed to stderr.
+func TraceProtocol(cb ProtoTraceHandler, maxPayload int) Option {
+	return func(o *Options) error {
+		if cb == nil {
+			cb = defaultProtoTraceHandler
+		}
+		o.ProtoTraceCB = cb
+		o.ProtoTracePayload = maxPayload
+		return nil
+	}
+}
+
+// CaptureProtocol is an Option to write the raw data exchanged with the
+// server to w, as timestamped frames that can be read with a CaptureReader
+// and replayed with ReplayCapture. The credentials of CONNECT are redacted.
+func CaptureProtocol(w io.Writer) Option {
+	return func(o *Options) error {
+		o.ProtoCapture = w
+		return nil
+	}
+}
+
+func defaultProtoTraceHandler(trace *ProtoTrace) {
+	fmt.Fprintf(os.Stderr, "nats: %s\n", trace)
+}
+
+// Maximum size of a control line kept while waiting for its end.
+const maxTraceLine = 64 * 1024
+
+// Credentials removed from CONNECT.
+var redactedConnectFields = []string{"pass", "auth_token", "jwt", "sig"}
+
+// redactConnect returns the CONNECT control line without its credentials.
+func redactConnect(line string) string {
+	args := strings.TrimSpace(line[len("CONNECT "):])
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &m); err != nil {
+		return "CONNECT [REDACTED]"
+	}
+	for _, f := range redactedConnectFields {
+		if _, ok := m[f]; ok {
+			m[f] = "[REDACTED]"
+		}
+	}
+	b, _ := json.Marshal(m)
+	return "CONNECT " + string(b)
+}
+
+func isConnect(data []byte) bool {
+	return len(data) > 8 && strings.EqualFold(string(data[:8]), "CONNECT ")
+}
+
+// protoTracer traces and captures the data exchanged on a connection.
+type protoTracer struct {
+	mu         sync.Mutex
+	cb         ProtoTraceHandler
+	maxPayload int
+	capture    io.Writer
+	clock      Clock
+	in, out    protoScanner
+}
+
+func newProtoTracer(o *Options) *protoTracer {
+	if o.ProtoTraceCB == nil && o.ProtoCapture == nil {
+		return nil
+	}
+	return &protoTracer{
+		cb:         o.ProtoTraceCB,
+		maxPayload: o.ProtoTracePayload,
+		capture:    o.ProtoCapture,
+		clock:      o.clock(),
+	}
+}
+
+// reset discards the partial operations of the previous connection.
+func (t *protoTracer) reset() {
+	t.mu.Lock()
+	t.in.buf, t.out.buf = nil, nil
+	t.mu.Unlock()
+}
+
+func (t *protoTracer) inbound(data []byte)  { t.trace(false, data) }
+func (t *protoTracer) outbound(data []byte) { t.trace(true, data) }
+
+func (t *protoTracer) trace(outbound bool, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.clock.Now()
+	if t.capture != nil {
+		frame := data
+		if outbound && isConnect(data) {
+			frame = []byte(redactConnect(strings.TrimRight(string(data), "\r\n")) + _CRLF_)
+		}
+		writeCaptureFrame(t.capture, now, outbound, frame)
+	}
+	if t.cb == nil {
+		return
+	}
+	s := &t.in
+	if outbound {
+		s = &t.out
+	}
+	s.feed(data, func(line string, payload []byte, size int) {
+		if isConnect([]byte(line)) {
+			line = redactConnect(line)
+		}
+		if len(payload) > t.maxPayload {
+			if t.maxPayload > 0 {
+				payload = payload[:t.maxPayload]
+			} else {
+				payload = nil
+			}
+		}
+		t.cb(&ProtoTrace{
+			Time:     now,
+			Outbound: outbound,
+			Op:       line,
+			Payload:  append([]byte(nil), payload...),
+			Size:     size,
+		})
+	})
+}
+
+// protoScanner splits a stream of protocol data into operations.
+type protoScanner struct {
+	buf []byte
+}
+
+// feed adds data to the stream and calls emit for each complete operation.
+func (s *protoScanner) feed(data []byte, emit func(line string, payload []byte, size int)) {
+	s.buf = append(s.buf, data...)
+	for {
+		i := bytes.Index(s.buf, []byte(_CRLF_))
+		if i < 0 {
+			if len(s.buf) > maxTraceLine {
+				emit(string(s.buf), nil, 0)
+				s.buf = nil
+			}
+			break
+		}
+		line := string(s.buf[:i])
+		consumed := i + len(_CRLF_)
+		var payload []byte
+		size := 0
+		if hasPayload(line) {
+			args := strings.Fields(line)
+			n, err := strconv.Atoi(args[len(args)-1])
+			if err == nil && n >= 0 {
+				if len(s.buf) < consumed+n+len(_CRLF_) {
+					// Wait for the rest of the payload.
+					break
+				}
+				payload, size = s.buf[consumed:consumed+n], n
+				consumed += n + len(_CRLF_)
+			}
+		}
+		emit(line, payload, size)
+		s.buf = s.buf[consumed:]
+	}
+	if len(s.buf) == 0 {
+		s.buf = nil
+	}
+}
+
+// hasPayload returns true for the operations followed by a payload.
+func hasPayload(line string) bool {
+	verb := line
+	if i := strings.IndexAny(line, " \t"); i > 0 {
+		verb = line[:i]
+	}
+	switch strings.ToUpper(verb) {
+	case "PUB", "HPUB", "MSG", "HMSG":
+		return true
+	}
+	return false
+}
+
+// Direction of the frames of a capture.
+const (
+	captureIn  = "IN"
+	captureOut = "OUT"
+)
+
+// writeCaptureFrame writes a frame: a header line with the direction, the
+// time in nanoseconds and the size of the data, followed by the data and CRLF.
+func writeCaptureFrame(w io.Writer, now time.Time, outbound bool, data []byte) error {
+	dir := captureIn
+	if outbound {
+		dir = captureOut
+	}
+	if _, err := fmt.Fprintf(w, "%s %d %d\r\n", dir, now.UnixNano(), len(data)); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte(_CRLF_))
+	return err
+}
+
+// CaptureFrame is a frame of a capture made with the CaptureProtocol() option.
+type CaptureFrame struct {
+	Time time.Time
+	// Outbound is true for the data sent by the client.
+	Outbound bool
+	// Data is the raw data, as it was written to or read from the
+	// connection.
+	Data []byte
+}
+
+// CaptureReader reads the frames of a capture.
+type CaptureReader struct {
+	r *bufio.Reader
+}
+
+// NewCaptureReader returns a CaptureReader reading from r.
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	return &CaptureReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next frame, or io.EOF at the end of the capture.
+func (cr *CaptureReader) Next() (*CaptureFrame, error) {
+	line, err := cr.r.ReadString('\n')
+	if err == io.EOF && line == _EMPTY_ {
+		return nil, io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	args := strings.Fields(line)
+	if len(args) != 3 || (args[0] != captureIn && args[0] != captureOut) {
+		return nil, ErrBadCapture
+	}
+	ns, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, ErrBadCapture
+	}
+	size, err := strconv.Atoi(args[2])
+	if err != nil || size < 0 {
+		return nil, ErrBadCapture
+	}
+	data := make([]byte, size+len(_CRLF_))
+	if _, err := io.ReadFull(cr.r, data); err != nil {
+		return nil, ErrBadCapture
+	}
+	return &CaptureFrame{
+		Time:     time.Unix(0, ns),
+		Outbound: args[0] == captureOut,
+		Data:     data[:size],
+	}, nil
+}
+
+// ReplayCapture feeds the inbound frames of a capture to the protocol parser
+// of an offline connection, with the same chunks of data as when they were
+// read, to reproduce client issues without a server. The subscriptions found
+// in the outbound frames are created, with their original sid, and their
+// messages are delivered to cb, which can be nil.
+//
+// The error of the parser is returned, if any, identifying the frame.
+func ReplayCapture(r io.Reader, cb MsgHandler) error {
+	if cb == nil {
+		cb = func(*Msg) {}
+	}
+	o := GetDefaultOptions()
+	o.AllowReconnect = false
+	o.AsyncErrorCB = func(*Conn, *Subscription, error) {}
+	nc := &Conn{Opts: o}
+	if err := nc.setupServerPool(); err != nil {
+		return err
+	}
+	nc.ach = &asyncCallbacksHandler{}
+	nc.ach.cond = sync.NewCond(&nc.ach.mu)
+	go nc.ach.asyncCBDispatcher()
+	nc.newReaderWriter()
+	nc.bw.w = ioutil.Discard
+	nc.subs = make(map[int64]*Subscription)
+	nc.pongs = make([]chan struct{}, 0, 8)
+	nc.ps = &parseState{}
+	nc.status = CONNECTED
+	defer nc.Close()
+
+	cr := NewCaptureReader(r)
+	var out protoScanner
+	for n := 1; ; n++ {
+		frame, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if frame.Outbound {
+			out.feed(frame.Data, func(line string, _ []byte, _ int) {
+				nc.replayOp(line, cb)
+			})
+			continue
+		}
+		nc.mu.Lock()
+		closed := nc.isClosed()
+		nc.mu.Unlock()
+		if closed {
+			return fmt.Errorf("nats: connection closed replaying frame %d", n)
+		}
+		if err := nc.parse(frame.Data); err != nil {
+			return fmt.Errorf("nats: error replaying frame %d: %w", n, err)
+		}
+	}
+
+	// Let the subscriptions deliver the messages.
+	for {
+		var pending int
+		nc.subsMu.RLock()
+		for _, sub := range nc.subs {
+			sub.mu.Lock()
+			pending += sub.pMsgs
+			sub.mu.Unlock()
+		}
+		nc.subsMu.RUnlock()
+		if pending == 0 {
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// replayOp applies the subscriptions of an outbound operation.
+func (nc *Conn) replayOp(line string, cb MsgHandler) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return
+	}
+	switch strings.ToUpper(args[0]) {
+	case "SUB":
+		if len(args) != 3 && len(args) != 4 {
+			return
+		}
+		sid, err := strconv.ParseInt(args[len(args)-1], 10, 64)
+		if err != nil {
+			return
+		}
+		sub := &Subscription{
+			Subject:     args[1],
+			mcb:         cb,
+			conn:        nc,
+			typ:         AsyncSubscription,
+			sid:         sid,
+			pMsgsLimit:  DefaultSubPendingMsgsLimit,
+			pBytesLimit: DefaultSubPendingBytesLimit,
+		}
+		if len(args) == 4 {
+			sub.Queue = args[2]
+		}
+		sub.pCond = sync.NewCond(&sub.mu)
+		nc.subsMu.Lock()
+		nc.subs[sid] = sub
+		nc.subsMu.Unlock()
+		go nc.waitForMsgs(sub)
+	case "UNSUB":
+		if len(args) != 2 {
+			// Auto unsubscribe is enforced by the delivery.
+			return
+		}
+		sid, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return
+		}
+		nc.subsMu.RLock()
+		sub := nc.subs[sid]
+		nc.subsMu.RUnlock()
+		if sub != nil {
+			nc.mu.Lock()
+			nc.removeSub(sub)
+			nc.mu.Unlock()
+		}
+	}
+}
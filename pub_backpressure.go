@@ -0,0 +1,89 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"context"
+	"time"
+)
+
+// PublishBackpressure is an Option to make publish calls block while the
+// outbound buffer, including the reconnect buffer, holds at least
+// highWaterMark bytes, instead of growing it or failing with
+// ErrReconnectBufExceeded. Publish calls without context fail with ErrTimeout
+// after blocking for timeout, or never if 0. Use PublishWithContext() or
+// PublishMsgWithContext() to bound the wait with a context instead.
+func PublishBackpressure(highWaterMark int, timeout time.Duration) Option {
+	return func(o *Options) error {
+		if highWaterMark <= 0 || timeout < 0 {
+			return ErrInvalidArg
+		}
+		o.PublishHighWaterMark = highWaterMark
+		o.PublishBlockTimeout = timeout
+		return nil
+	}
+}
+
+// waitForPublishBuffer waits until the outbound buffer has room for size more
+// bytes below the high-water mark, or is empty, ctx is done or, without
+// context, the PublishBlockTimeout option expires.
+// Connection lock is held on entry, and on return.
+func (nc *Conn) waitForPublishBuffer(ctx context.Context, size int) error {
+	var done <-chan struct{}
+	var expired <-chan time.Time
+	if ctx != nil {
+		done = ctx.Done()
+	} else if timeout := nc.Opts.PublishBlockTimeout; timeout > 0 {
+		t := nc.getTimer(timeout)
+		defer nc.putTimer(t)
+		expired = t.C()
+	}
+	for {
+		if nc.isClosed() {
+			return ErrConnectionClosed
+		}
+		if nc.isDrainingPubs() {
+			return ErrConnectionDraining
+		}
+		if buffered := nc.bw.buffered(); buffered == 0 || buffered+size < nc.Opts.PublishHighWaterMark {
+			return nil
+		}
+		if nc.pubWait == nil {
+			nc.pubWait = make(chan struct{})
+		}
+		ch := nc.pubWait
+		nc.kickFlusher()
+		nc.mu.Unlock()
+		select {
+		case <-ch:
+		case <-done:
+			nc.mu.Lock()
+			return ctx.Err()
+		case <-expired:
+			nc.mu.Lock()
+			return ErrTimeout
+		}
+		nc.mu.Lock()
+	}
+}
+
+// releasePublishers wakes up the publish calls waiting for the outbound
+// buffer to be flushed.
+// Connection lock is held on entry.
+func (nc *Conn) releasePublishers() {
+	if nc.pubWait != nil {
+		close(nc.pubWait)
+		nc.pubWait = nil
+	}
+}
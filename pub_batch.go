@@ -0,0 +1,133 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import "net"
+
+// PublishBatch publishes the messages in order, acquiring the connection lock
+// once for the whole batch. Payloads of at least the size of the outbound
+// buffer are written without being copied, along with the data buffered
+// before them, using vectored writes when possible.
+//
+// With the PublishBackpressure option, the call waits once, before publishing
+// any message, for the outbound buffer to have room for the whole batch, or
+// to be empty. The lock is then held until the batch is published, so that
+// it is not interleaved with other publish calls.
+//
+// It returns nil if all the messages were published, or else the error of
+// each message at its index, nil for the messages published.
+func (nc *Conn) PublishBatch(msgs []*Msg) []error {
+	var errs []error
+	setErr := func(i int, err error) {
+		if errs == nil {
+			errs = make([]error, len(msgs))
+		}
+		errs[i] = err
+	}
+	setAll := func(from int, err error) {
+		for i := from; i < len(msgs); i++ {
+			setErr(i, err)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	if nc == nil {
+		setAll(0, ErrInvalidConnection)
+		return errs
+	}
+
+	// Check the messages before acquiring the lock, and get the size of
+	// the batch.
+	hdrs := make([][]byte, len(msgs))
+	var batchSize int
+	for i, m := range msgs {
+		if m == nil {
+			setErr(i, ErrInvalidMsg)
+			continue
+		}
+		if m.Subject == _EMPTY_ {
+			setErr(i, ErrBadSubject)
+			continue
+		}
+		hdr, err := m.headerBytes()
+		if err != nil {
+			setErr(i, err)
+			continue
+		}
+		hdrs[i] = hdr
+		batchSize += len(hdr) + len(m.Data)
+	}
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if nc.isClosed() {
+		setAll(0, ErrConnectionClosed)
+		return errs
+	}
+	if nc.isDrainingPubs() {
+		setAll(0, ErrConnectionDraining)
+		return errs
+	}
+	// Slow down to the pace of the network if backpressure is enabled.
+	if nc.Opts.PublishHighWaterMark > 0 {
+		if err := nc.waitForPublishBuffer(nil, batchSize); err != nil {
+			setAll(0, err)
+			return errs
+		}
+	}
+
+	var published bool
+	for i, m := range msgs {
+		if errs != nil && errs[i] != nil {
+			continue
+		}
+		hdr := hdrs[i]
+		if len(hdr) > 0 && !nc.info.Headers {
+			setErr(i, ErrHeadersNotSupported)
+			continue
+		}
+		msgSize := int64(len(m.Data) + len(hdr))
+		if !nc.initc && msgSize > nc.info.MaxPayload {
+			setErr(i, ErrMaxPayload)
+			continue
+		}
+		if nc.bw.atLimitIfUsingPending() {
+			setErr(i, ErrReconnectBufExceeded)
+			continue
+		}
+
+		var err error
+		mh := nc.pubProto(m.Subject, m.Reply, hdr, msgSize)
+		if len(m.Data) >= nc.bw.limit {
+			err = nc.bw.writeBuffers(net.Buffers{mh, hdr, m.Data, _CRLF_BYTES_})
+		} else {
+			err = nc.bw.appendBufs(mh, hdr, m.Data, _CRLF_BYTES_)
+		}
+		if err != nil {
+			// The connection is broken, the read loop will handle it.
+			setAll(i, err)
+			break
+		}
+		published = true
+		nc.OutMsgs++
+		nc.OutBytes += uint64(msgSize)
+	}
+
+	if published && len(nc.fch) == 0 {
+		nc.kickFlusher()
+	}
+	return errs
+}
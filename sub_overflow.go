@@ -0,0 +1,564 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// OverflowPolicy is what a subscription does with the messages received when
+// its pending limits are exceeded, see Subscription.SetOverflowPolicy().
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest drops the received message. This is the default.
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest pending messages to make room for
+	// the received message.
+	OverflowDropOldest
+	// OverflowConflate keeps only the latest pending message of each subject
+	// once the limits are exceeded: a received message then replaces the
+	// pending message of the same subject, if any, in place. Messages of new
+	// subjects are dropped.
+	OverflowConflate
+	// OverflowSpill writes the messages to a file until the subscription
+	// catches up, see Subscription.SetOverflowSpill().
+	OverflowSpill
+)
+
+// DefaultSpillBytesLimit is the default maximum size of the spill file of a
+// subscription, 1GB.
+const DefaultSpillBytesLimit = 1024 * 1024 * 1024
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropNewest:
+		return "DropNewest"
+	case OverflowDropOldest:
+		return "DropOldest"
+	case OverflowConflate:
+		return "Conflate"
+	case OverflowSpill:
+		return "Spill"
+	default:
+		return "Unknown"
+	}
+}
+
+// OverflowStats are the counters of the overflow policies of a subscription.
+type OverflowStats struct {
+	// DroppedNewest is the number of received messages dropped because the
+	// pending limits were exceeded.
+	DroppedNewest uint64
+	// DroppedOldest is the number of pending messages dropped.
+	DroppedOldest uint64
+	// Conflated is the number of pending messages replaced by a message of
+	// the same subject.
+	Conflated uint64
+	// Spilled is the number of messages written to the spill file.
+	Spilled uint64
+	// SpillDropped is the number of received messages dropped because the
+	// spill file was full, or could not be written or read.
+	SpillDropped uint64
+	// SpillPending is the number of messages in the spill file.
+	SpillPending int
+}
+
+var errSpillFull = errors.New("nats: spill file is full")
+
+// Results of applyOverflowPolicy.
+const (
+	ovfDeliver = iota
+	ovfDrop
+	ovfSpillFull
+	ovfQueued
+)
+
+// SetOverflowPolicy sets what the subscription does with the messages received
+// when its pending limits are exceeded. Subscriptions bound to JetStream only
+// support OverflowDropNewest, since dropping messages already accepted would
+// break the tracking of the consumer sequences. OverflowConflate and
+// OverflowSpill are only supported by asynchronous subscriptions. With
+// OverflowSpill, the messages are written to a file of the temporary directory
+// of up to DefaultSpillBytesLimit, use SetOverflowSpill() to change those.
+func (s *Subscription) SetOverflowPolicy(policy OverflowPolicy) error {
+	return s.setOverflowPolicy(policy, _EMPTY_, DefaultSpillBytesLimit)
+}
+
+// SetOverflowSpill sets the OverflowSpill policy, writing the messages to a
+// file of dir, or of the temporary directory if empty, of up to maxBytes, or
+// unlimited if negative. The messages received when the file is full are
+// dropped. Messages are delivered in order: once a message has been spilled,
+// the following ones are too until the subscription catches up. The file is
+// written by a goroutine of the subscription, not by the connection's read
+// loop, and is removed when the subscription is closed.
+func (s *Subscription) SetOverflowSpill(dir string, maxBytes int64) error {
+	if maxBytes == 0 {
+		return ErrInvalidArg
+	}
+	return s.setOverflowPolicy(OverflowSpill, dir, maxBytes)
+}
+
+func (s *Subscription) setOverflowPolicy(policy OverflowPolicy, dir string, maxBytes int64) error {
+	if s == nil {
+		return ErrBadSubscription
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil || s.closed {
+		return ErrBadSubscription
+	}
+	if s.typ == ChanSubscription {
+		return ErrTypeSubscription
+	}
+	switch policy {
+	case OverflowDropNewest:
+	case OverflowDropOldest:
+		if s.jsi != nil {
+			return ErrTypeSubscription
+		}
+	case OverflowConflate, OverflowSpill:
+		if s.typ != AsyncSubscription || s.jsi != nil {
+			return ErrTypeSubscription
+		}
+	default:
+		return ErrInvalidArg
+	}
+	s.ovfPolicy = policy
+	s.ovfLast = nil
+	if policy == OverflowConflate {
+		s.ovfLast = make(map[string]*Msg)
+	}
+	if policy == OverflowSpill {
+		if s.spill == nil {
+			s.spill = &subSpill{}
+		}
+		// A spill file already created is kept until the subscription is closed.
+		s.spill.dir, s.spill.max = dir, maxBytes
+	}
+	// Messages already spilled are still delivered with any other policy.
+	return nil
+}
+
+// OverflowPolicy returns the overflow policy of the subscription.
+func (s *Subscription) OverflowPolicy() (OverflowPolicy, error) {
+	if s == nil {
+		return OverflowDropNewest, ErrBadSubscription
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil || s.closed {
+		return OverflowDropNewest, ErrBadSubscription
+	}
+	return s.ovfPolicy, nil
+}
+
+// OverflowStats returns the counters of the overflow policies of the
+// subscription.
+func (s *Subscription) OverflowStats() (OverflowStats, error) {
+	if s == nil {
+		return OverflowStats{}, ErrBadSubscription
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil || s.closed {
+		return OverflowStats{}, ErrBadSubscription
+	}
+	stats := s.ovfStats
+	if s.spill != nil {
+		stats.SpillPending = s.spill.n
+	}
+	return stats, nil
+}
+
+// overLimits returns true if the pending limits are exceeded.
+// Lock is held on entry.
+func (s *Subscription) overLimits() bool {
+	return (s.pMsgsLimit > 0 && s.pMsgs > s.pMsgsLimit) ||
+		(s.pBytesLimit > 0 && s.pBytes > s.pBytesLimit)
+}
+
+// applyOverflowPolicy is called by processMsg for a received message, already
+// accounted for in the pending stats. It returns ovfDeliver if the message
+// is to be delivered, ovfDrop or ovfSpillFull if it is to be dropped, or
+// ovfQueued if the policy took care of it.
+// Lock is held on entry.
+func (s *Subscription) applyOverflowPolicy(m *Msg) int {
+	if s.spill != nil && (s.spill.n > 0 || (s.ovfPolicy == OverflowSpill && s.overLimits())) {
+		s.pMsgs--
+		s.pBytes -= len(m.Data)
+		if err := s.spillMsg(m); err != nil {
+			s.pMsgs++
+			s.pBytes += len(m.Data)
+			return ovfSpillFull
+		}
+		s.ovfStats.Spilled++
+		return ovfQueued
+	}
+	switch s.ovfPolicy {
+	case OverflowDropOldest:
+		for s.overLimits() && s.dropOldest() {
+		}
+	case OverflowConflate:
+		if !s.overLimits() {
+			s.ovfLast[m.Subject] = m
+			return ovfDeliver
+		}
+		if old := s.ovfLast[m.Subject]; old != nil {
+			s.pMsgs--
+			s.pBytes -= len(old.Data)
+			old.Header, old.Data, old.Reply = m.Header, m.Data, m.Reply
+			// With pooled messages, the pending message takes the payload
+			// buffer of the received one, which is released with the
+			// buffer of the replaced payload.
+			old.buf, m.buf = m.buf, old.buf
+			old.pool, m.pool = m.pool, old.pool
+			m.Header, m.Data = nil, nil
+			if m.pool == msgInUse {
+				m.Release()
+			}
+			s.ovfStats.Conflated++
+			return ovfQueued
+		}
+	}
+	if s.overLimits() {
+		return ovfDrop
+	}
+	return ovfDeliver
+}
+
+// dropOldest drops the oldest pending message, if any.
+// Lock is held on entry.
+func (s *Subscription) dropOldest() bool {
+	var old *Msg
+	if s.mch != nil {
+		select {
+		case old = <-s.mch:
+		default:
+			return false
+		}
+	} else {
+		var prev *Msg
+		for m := s.pHead; m != nil; prev, m = m, m.next {
+			// Barriers are not messages.
+			if m.barrier != nil {
+				continue
+			}
+			if prev == nil {
+				s.pHead = m.next
+			} else {
+				prev.next = m.next
+			}
+			if s.pTail == m {
+				s.pTail = prev
+			}
+			m.next = nil
+			old = m
+			break
+		}
+		if old == nil {
+			return false
+		}
+	}
+	s.pMsgs--
+	s.pBytes -= len(old.Data)
+	s.dropped++
+	s.ovfStats.DroppedOldest++
+	return true
+}
+
+// sendDroppingOldest is called by processMsg when the channel of a
+// synchronous subscription is full, to drop the oldest message with the
+// OverflowDropOldest policy.
+// Lock is held on entry.
+func (s *Subscription) sendDroppingOldest(m *Msg) bool {
+	if s.ovfPolicy != OverflowDropOldest || !s.dropOldest() {
+		return false
+	}
+	select {
+	case s.mch <- m:
+		return true
+	default:
+		return false
+	}
+}
+
+// spillMsg queues the message to be written to the spill file, starting the
+// writer of the subscription if needed. No file I/O is done here, since this
+// runs in the read loop.
+// Lock is held on entry.
+func (s *Subscription) spillMsg(m *Msg) error {
+	sp := s.spill
+	rec, err := encodeSpillRec(m)
+	if err != nil {
+		return err
+	}
+	if sp.max > 0 && sp.size+int64(len(rec)) > sp.max {
+		return errSpillFull
+	}
+	sp.queue = append(sp.queue, spillRec{m, rec})
+	sp.n++
+	sp.size += int64(len(rec))
+	if sp.wch == nil {
+		sp.wch = make(chan struct{}, 1)
+		sp.quit = make(chan struct{})
+		go s.spillWriter(sp)
+	}
+	select {
+	case sp.wch <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// spillWriter writes the queued messages to the spill file, until the spill
+// file is closed.
+func (s *Subscription) spillWriter(sp *subSpill) {
+	for {
+		select {
+		case <-sp.quit:
+			sp.closeFile()
+			return
+		default:
+		}
+		select {
+		case <-sp.quit:
+			sp.closeFile()
+			return
+		case <-sp.wch:
+		}
+
+		s.mu.Lock()
+		recs, dir, reset := sp.queue, sp.dir, sp.reset
+		sp.queue, sp.reset = nil, false
+		sp.inflight += len(recs)
+		s.mu.Unlock()
+
+		err := sp.writeRecs(recs, dir, reset)
+
+		s.mu.Lock()
+		sp.inflight -= len(recs)
+		if err != nil {
+			// The messages are lost.
+			sp.n -= len(recs)
+			s.dropped += len(recs)
+			s.ovfStats.SpillDropped += uint64(len(recs))
+			if sp.n == 0 {
+				sp.emptied()
+			}
+		} else {
+			for _, r := range recs {
+				sp.sizes = append(sp.sizes, len(r.rec))
+			}
+		}
+		if s.pCond != nil {
+			s.pCond.Broadcast()
+		}
+		nc := s.conn
+		s.mu.Unlock()
+
+		if err != nil && nc != nil {
+			nc.mu.Lock()
+			nc.pushAsyncErr(s, err)
+			nc.mu.Unlock()
+		}
+	}
+}
+
+// unspill moves the oldest spilled message to the pending list, unless it is
+// still being written. The lock is released while reading the spill file.
+// If the message could not be read, it is dropped.
+// Lock is held on entry.
+func (s *Subscription) unspill() error {
+	sp := s.spill
+	var m *Msg
+	switch {
+	case len(sp.sizes) > 0:
+		size, off := sp.sizes[0], sp.rOff
+		sp.sizes = sp.sizes[1:]
+		sp.rOff += int64(size)
+		s.mu.Unlock()
+		var err error
+		m, err = sp.read(off, size)
+		s.mu.Lock()
+		if err != nil {
+			if sp.n--; sp.n == 0 {
+				sp.emptied()
+			}
+			s.dropped++
+			s.ovfStats.SpillDropped++
+			return err
+		}
+	case sp.inflight > 0:
+		// Wait for the writer.
+		return nil
+	default:
+		// Not written yet, there is no need to.
+		m = sp.queue[0].m
+		sp.queue[0] = spillRec{}
+		sp.queue = sp.queue[1:]
+	}
+	if sp.n--; sp.n == 0 {
+		sp.emptied()
+	}
+	m.Sub = s
+	s.pMsgs++
+	s.pBytes += len(m.Data)
+	if s.pTail == nil {
+		s.pHead = m
+	} else {
+		s.pTail.next = m
+	}
+	s.pTail = m
+	return nil
+}
+
+// subSpill is the spill file of a subscription. Each message is a record of
+// the lengths of its subject, reply, headers and data, as 32-bit integers,
+// followed by their bytes.
+//
+// The messages are queued by processMsg, written by the spillWriter goroutine
+// of the subscription and read back by its delivery goroutine. Messages are
+// in the file, then being written, then queued, in that order.
+type subSpill struct {
+	// Protected by the subscription lock.
+	dir      string
+	max      int64
+	queue    []spillRec
+	inflight int
+	sizes    []int
+	n        int
+	size     int64
+	rOff     int64
+	reset    bool
+	wch      chan struct{}
+	quit     chan struct{}
+
+	// Owned by the spillWriter goroutine. The file is only read once the
+	// records are written.
+	f    *os.File
+	wOff int64
+}
+
+// spillRec is a queued message and its record.
+type spillRec struct {
+	m   *Msg
+	rec []byte
+}
+
+const spillRecHdrLen = 16
+
+func encodeSpillRec(m *Msg) ([]byte, error) {
+	hdr, err := m.headerBytes()
+	if err != nil {
+		return nil, err
+	}
+	size := spillRecHdrLen + len(m.Subject) + len(m.Reply) + len(hdr) + len(m.Data)
+	rec := make([]byte, spillRecHdrLen, size)
+	binary.BigEndian.PutUint32(rec[0:], uint32(len(m.Subject)))
+	binary.BigEndian.PutUint32(rec[4:], uint32(len(m.Reply)))
+	binary.BigEndian.PutUint32(rec[8:], uint32(len(hdr)))
+	binary.BigEndian.PutUint32(rec[12:], uint32(len(m.Data)))
+	rec = append(rec, m.Subject...)
+	rec = append(rec, m.Reply...)
+	rec = append(rec, hdr...)
+	rec = append(rec, m.Data...)
+	return rec, nil
+}
+
+// emptied is called once all the spilled messages are delivered, to reuse
+// the file from the start.
+// Subscription lock is held on entry.
+func (sp *subSpill) emptied() {
+	sp.size, sp.rOff, sp.reset = 0, 0, true
+}
+
+// writeRecs appends the records to the spill file, creating it in dir if
+// needed, or emptying it first if reset.
+func (sp *subSpill) writeRecs(recs []spillRec, dir string, reset bool) error {
+	if sp.f == nil {
+		f, err := os.CreateTemp(dir, "nats-spill-*")
+		if err != nil {
+			return err
+		}
+		sp.f = f
+	} else if reset {
+		sp.wOff = 0
+		sp.f.Truncate(0)
+	}
+	for _, r := range recs {
+		if _, err := sp.f.WriteAt(r.rec, sp.wOff); err != nil {
+			return err
+		}
+		sp.wOff += int64(len(r.rec))
+	}
+	return nil
+}
+
+func (sp *subSpill) read(off int64, size int) (*Msg, error) {
+	buf := make([]byte, size)
+	if _, err := sp.f.ReadAt(buf, off); err != nil {
+		return nil, spillReadErr(err)
+	}
+	sl := int(binary.BigEndian.Uint32(buf[0:]))
+	rl := int(binary.BigEndian.Uint32(buf[4:]))
+	hl := int(binary.BigEndian.Uint32(buf[8:]))
+	dl := int(binary.BigEndian.Uint32(buf[12:]))
+	if spillRecHdrLen+sl+rl+hl+dl != size {
+		return nil, spillReadErr(io.ErrUnexpectedEOF)
+	}
+	buf = buf[spillRecHdrLen:]
+	m := &Msg{
+		Subject: string(buf[:sl]),
+		Reply:   string(buf[sl : sl+rl]),
+		Data:    buf[sl+rl+hl:],
+	}
+	if hl > 0 {
+		h, err := decodeHeadersMsg(buf[sl+rl : sl+rl+hl])
+		if err != nil {
+			return nil, err
+		}
+		m.Header = h
+	}
+	return m, nil
+}
+
+func spillReadErr(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return errors.New("nats: error reading spill file: " + err.Error())
+}
+
+// close drops the spilled messages, and stops the writer which removes the
+// file.
+// Subscription lock is held on entry.
+func (sp *subSpill) close() {
+	sp.queue, sp.sizes, sp.n = nil, nil, 0
+	if sp.quit != nil {
+		close(sp.quit)
+	}
+}
+
+// closeFile removes the spill file. Called by the spillWriter goroutine.
+func (sp *subSpill) closeFile() {
+	if sp.f != nil {
+		sp.f.Close()
+		os.Remove(sp.f.Name())
+		sp.f = nil
+	}
+}
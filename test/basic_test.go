@@ -221,6 +221,66 @@ func TestSimplePublishNoData(t *testing.T) {
 	}
 }
 
+func TestPublishBatch(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("batch.>")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	nc.Flush()
+
+	if errs := nc.PublishBatch(nil); errs != nil {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+
+	large := bytes.Repeat([]byte("x"), 128*1024)
+	hm := nats.NewMsg("batch.hdr")
+	hm.Header.Set("Foo", "Bar")
+	hm.Data = []byte("with header")
+	msgs := []*nats.Msg{
+		{Subject: "batch.1", Data: []byte("one")},
+		nil,
+		hm,
+		{Subject: "", Data: []byte("no subject")},
+		{Subject: "batch.large", Reply: "reply", Data: large},
+		{Subject: "batch.2"},
+	}
+	errs := nc.PublishBatch(msgs)
+	if len(errs) != len(msgs) {
+		t.Fatalf("Expected %d errors, got %v", len(msgs), errs)
+	}
+	for i, expected := range []error{nil, nats.ErrInvalidMsg, nil, nats.ErrBadSubject, nil, nil} {
+		if errs[i] != expected {
+			t.Fatalf("Expected error %v for message %d, got %v", expected, i, errs[i])
+		}
+	}
+	for _, expected := range []*nats.Msg{msgs[0], msgs[2], msgs[4], msgs[5]} {
+		m, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("Error on next msg: %v", err)
+		}
+		if m.Subject != expected.Subject || m.Reply != expected.Reply || !bytes.Equal(m.Data, expected.Data) {
+			t.Fatalf("Expected message on %q, got %q %q %d bytes", expected.Subject, m.Subject, m.Reply, len(m.Data))
+		}
+		if m.Header.Get("Foo") != expected.Header.Get("Foo") {
+			t.Fatalf("Unexpected header: %v", m.Header)
+		}
+	}
+	if nc.OutMsgs != 4 {
+		t.Fatalf("Expected 4 messages out, got %d", nc.OutMsgs)
+	}
+
+	nc.Close()
+	errs = nc.PublishBatch(msgs[:2])
+	if len(errs) != 2 || errs[0] != nats.ErrConnectionClosed || errs[1] != nats.ErrConnectionClosed {
+		t.Fatalf("Expected connection closed errors, got %v", errs)
+	}
+}
+
 func TestPublishDoesNotFailOnSlowConsumer(t *testing.T) {
 	s := RunDefaultServer()
 	defer s.Shutdown()
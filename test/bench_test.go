@@ -41,13 +41,63 @@ func BenchmarkPublishSpeed(b *testing.B) {
 	b.StopTimer()
 }
 
-func BenchmarkPubSubSpeed(b *testing.B) {
+func benchmarkPublishBatch(b *testing.B, size int, batch bool) {
 	b.StopTimer()
 	s := RunDefaultServer()
 	defer s.Shutdown()
 	nc := NewDefaultConnection(b)
 	defer nc.Close()
 
+	const batchSize = 100
+	msgs := make([]*nats.Msg, batchSize)
+	for i := range msgs {
+		msgs[i] = &nats.Msg{Subject: "foo", Data: make([]byte, size)}
+	}
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.StartTimer()
+
+	for i := 0; i < b.N; i += batchSize {
+		n := batchSize
+		if b.N-i < n {
+			n = b.N - i
+		}
+		if batch {
+			if errs := nc.PublishBatch(msgs[:n]); errs != nil {
+				b.Fatalf("Error in benchmark during PublishBatch: %v\n", errs)
+			}
+			continue
+		}
+		for _, m := range msgs[:n] {
+			if err := nc.PublishMsg(m); err != nil {
+				b.Fatalf("Error in benchmark during PublishMsg: %v\n", err)
+			}
+		}
+	}
+	// Make sure they are all processed.
+	nc.Flush()
+	b.StopTimer()
+}
+
+func BenchmarkPublishLoopSmall(b *testing.B)  { benchmarkPublishBatch(b, 16, false) }
+func BenchmarkPublishBatchSmall(b *testing.B) { benchmarkPublishBatch(b, 16, true) }
+func BenchmarkPublishLoopLarge(b *testing.B)  { benchmarkPublishBatch(b, 64*1024, false) }
+func BenchmarkPublishBatchLarge(b *testing.B) { benchmarkPublishBatch(b, 64*1024, true) }
+
+func benchmarkPubSubSpeed(b *testing.B, pooled bool) {
+	b.StopTimer()
+	s := RunDefaultServer()
+	defer s.Shutdown()
+	var opts []nats.Option
+	if pooled {
+		opts = append(opts, nats.PooledMsgs())
+	}
+	nc, err := nats.Connect(nats.DefaultURL, opts...)
+	if err != nil {
+		b.Fatalf("Failed to create default connection: %v\n", err)
+	}
+	defer nc.Close()
+
 	ch := make(chan bool)
 
 	nc.SetErrorHandler(func(nc *nats.Conn, s *nats.Subscription, err error) {
@@ -57,6 +107,9 @@ func BenchmarkPubSubSpeed(b *testing.B) {
 	received := int32(0)
 
 	nc.Subscribe("foo", func(m *nats.Msg) {
+		if pooled {
+			m.Release()
+		}
 		if nr := atomic.AddInt32(&received, 1); nr >= int32(b.N) {
 			ch <- true
 		}
@@ -64,6 +117,7 @@ func BenchmarkPubSubSpeed(b *testing.B) {
 
 	msg := []byte("Hello World")
 
+	b.ReportAllocs()
 	b.StartTimer()
 
 	for i := 0; i < b.N; i++ {
@@ -73,7 +127,7 @@ func BenchmarkPubSubSpeed(b *testing.B) {
 	}
 
 	// Make sure they are all processed.
-	err := WaitTime(ch, 10*time.Second)
+	err = WaitTime(ch, 10*time.Second)
 	if err != nil {
 		b.Fatal("Timed out waiting for messages")
 	} else if atomic.LoadInt32(&received) != int32(b.N) {
@@ -82,6 +136,9 @@ func BenchmarkPubSubSpeed(b *testing.B) {
 	b.StopTimer()
 }
 
+func BenchmarkPubSubSpeed(b *testing.B)       { benchmarkPubSubSpeed(b, false) }
+func BenchmarkPubSubSpeedPooled(b *testing.B) { benchmarkPubSubSpeed(b, true) }
+
 func BenchmarkAsyncSubscriptionCreationSpeed(b *testing.B) {
 	b.StopTimer()
 	s := RunDefaultServer()
@@ -16,6 +16,7 @@ package test
 import (
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -411,6 +412,29 @@ func TestJetStreamPublish(t *testing.T) {
 	}
 }
 
+func TestJetStreamSubscribeOverflowPolicy(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sub, err := js.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer sub.Unsubscribe()
+	if err := sub.SetOverflowPolicy(nats.OverflowDropOldest); err != nats.ErrTypeSubscription {
+		t.Fatalf("Expected %v, got %v", nats.ErrTypeSubscription, err)
+	}
+	if err := sub.SetOverflowPolicy(nats.OverflowDropNewest); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
 func TestJetStreamSubscribe(t *testing.T) {
 	s := RunBasicJetStreamServer()
 	defer shutdownJSServerAndRemoveStorage(t, s)
@@ -2209,6 +2233,69 @@ func TestStreamInfoSubjectInfo(t *testing.T) {
 	}
 }
 
+func TestStreamInfoSubjectsPages(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// A stream info responder returning the subjects in pages of 2.
+	subjects := []string{"foo.A", "foo.B", "foo.C", "foo.D", "foo.E"}
+	var requests []string
+	_, err = nc.Subscribe("$JS.API.STREAM.INFO.PAGED", func(m *nats.Msg) {
+		requests = append(requests, string(m.Data))
+		var req struct {
+			Offset int `json:"offset"`
+		}
+		json.Unmarshal(m.Data, &req)
+		page := make(map[string]uint64)
+		for i := req.Offset; i < len(subjects) && i < req.Offset+2; i++ {
+			page[subjects[i]] = uint64(i + 1)
+		}
+		resp, _ := json.Marshal(map[string]interface{}{
+			"type":   "io.nats.jetstream.api.v1.stream_info_response",
+			"total":  len(subjects),
+			"offset": req.Offset,
+			"limit":  2,
+			"config": map[string]interface{}{"name": "PAGED"},
+			"state":  map[string]interface{}{"subjects": page},
+		})
+		m.Respond(resp)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	si, err := js.StreamInfo("PAGED", &nats.StreamInfoRequest{SubjectsFilter: "foo.*"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(si.State.Subjects) != len(subjects) {
+		t.Fatalf("Expected %d subjects, got %v", len(subjects), si.State.Subjects)
+	}
+	for i, subj := range subjects {
+		if si.State.Subjects[subj] != uint64(i+1) {
+			t.Fatalf("Unexpected count for %q: %v", subj, si.State.Subjects)
+		}
+	}
+	expected := []string{
+		`{"offset":0,"subjects_filter":"foo.*"}`,
+		`{"offset":2,"subjects_filter":"foo.*"}`,
+		`{"offset":4,"subjects_filter":"foo.*"}`,
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("Unexpected requests: %v", requests)
+	}
+}
+
 func TestStreamInfoDeletedDetails(t *testing.T) {
 	testData := []string{"one", "two", "three", "four"}
 
@@ -15,9 +15,12 @@ package test
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
@@ -301,6 +304,524 @@ func TestKeyValueWatchContextUpdates(t *testing.T) {
 	}
 }
 
+func TestKeyValueWatchResume(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "RESUME", History: 5})
+	expectOk(t, err)
+
+	for i := 1; i <= 5; i++ {
+		_, err := kv.PutString("name", strconv.Itoa(i))
+		expectOk(t, err)
+	}
+
+	expectUpdates := func(w nats.KeyWatcher, commit bool, revs ...uint64) {
+		t.Helper()
+		for _, rev := range revs {
+			select {
+			case v := <-w.Updates():
+				if v == nil || v.Revision() != rev {
+					t.Fatalf("Expected revision %d, got %+v", rev, v)
+				}
+				if commit {
+					expectOk(t, v.(nats.RevisionCommitter).CommitRevision())
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Did not receive an update like expected")
+			}
+		}
+		select {
+		case v := <-w.Updates():
+			if v != nil {
+				t.Fatalf("Expected init done marker, got %+v", v)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Did not receive a init done like expected")
+		}
+	}
+
+	w, err := kv.Watch("name", nats.ResumeFromRevision(3))
+	expectOk(t, err)
+	expectUpdates(w, false, 3, 4, 5)
+	w.Stop()
+
+	checkStore := func(store nats.RevisionStore) {
+		t.Helper()
+		e, err := kv.Get("name")
+		expectOk(t, err)
+		last := e.Revision()
+		w, err := kv.Watch("name", nats.PersistRevision(store))
+		expectOk(t, err)
+		expectUpdates(w, true, last)
+		if rev, err := store.LoadRevision(); err != nil || rev != last {
+			t.Fatalf("Expected revision %d to be stored, got %d (%v)", last, rev, err)
+		}
+		w.Stop()
+
+		// Simulate a restart, we should only get what was added since.
+		rev, err := kv.PutString("name", "new")
+		expectOk(t, err)
+		w, err = kv.Watch("name", nats.PersistRevision(store))
+		expectOk(t, err)
+		// Not committed, so delivered again after a restart.
+		expectUpdates(w, false, rev)
+		w.Stop()
+		w, err = kv.Watch("name", nats.PersistRevision(store))
+		expectOk(t, err)
+		expectUpdates(w, true, rev)
+		w.Stop()
+	}
+
+	checkStore(nats.FileRevisionStore(filepath.Join(t.TempDir(), "rev")))
+
+	rkv, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "REVS"})
+	expectOk(t, err)
+	checkStore(nats.KeyValueRevisionStore(rkv, "watcher"))
+
+	// The store can not be in the watched bucket.
+	_, err = kv.Watch("name", nats.PersistRevision(nats.KeyValueRevisionStore(kv, "watcher")))
+	expectErr(t, err, nats.ErrRevisionStoreInBucket)
+
+	// Entries of a watcher without store can not be committed.
+	w, err = kv.Watch("name")
+	expectOk(t, err)
+	e := <-w.Updates()
+	expectErr(t, e.(nats.RevisionCommitter).CommitRevision(), nats.ErrNoRevisionStore)
+	w.Stop()
+
+	// Make sure we detect that the revision is gone.
+	expectOk(t, js.PurgeStream("KV_RESUME"))
+	_, err = kv.Watch("name", nats.ResumeFromRevision(2))
+	expectErr(t, err, nats.ErrRevisionCompacted)
+
+	// Revisions replaced because of the history limit are skipped, the
+	// latest values are still delivered.
+	hkv, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "HIST"})
+	expectOk(t, err)
+	for _, key := range []string{"a", "b", "b", "c", "b", "c"} {
+		_, err := hkv.PutString(key, "value")
+		expectOk(t, err)
+	}
+	w, err = hkv.Watch("b", nats.ResumeFromRevision(2))
+	expectOk(t, err)
+	expectUpdates(w, false, 5)
+	w.Stop()
+	w, err = hkv.Watch(">", nats.ResumeFromRevision(2))
+	expectOk(t, err)
+	expectUpdates(w, false, 5, 6)
+	w.Stop()
+
+	// Removed from the start of the stream by a purge of the bucket.
+	expectOk(t, js.PurgeStream("KV_HIST", &nats.StreamPurgeRequest{Keep: 1}))
+	_, err = hkv.Watch(">", nats.ResumeFromRevision(5))
+	expectErr(t, err, nats.ErrRevisionCompacted)
+}
+
+func TestKeyValueEncoded(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "ENC"})
+	expectOk(t, err)
+
+	_, err = nats.NewEncodedKeyValue(kv, "foo22")
+	expectErr(t, err)
+
+	ekv, err := nats.NewEncodedKeyValue(kv, nats.JSON_ENCODER)
+	expectOk(t, err)
+
+	type person struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	w, err := ekv.WatchAll(&person{})
+	expectOk(t, err)
+	defer w.Stop()
+
+	expectUpdate := func(key string, p *person, decodeErr bool) {
+		t.Helper()
+		select {
+		case e := <-w.Updates():
+			if e == nil {
+				t.Fatalf("Expected an update, got init done marker")
+			}
+			if e.Key() != key {
+				t.Fatalf("Expected key %q, got %q", key, e.Key())
+			}
+			if decodeErr {
+				if e.Err == nil || e.Decoded != nil {
+					t.Fatalf("Expected a decode error, got %+v", e)
+				}
+				return
+			}
+			expectOk(t, e.Err)
+			if p == nil {
+				if e.Decoded != nil {
+					t.Fatalf("Expected no decoded value, got %+v", e.Decoded)
+				}
+				return
+			}
+			if got := e.Decoded.(*person); !reflect.DeepEqual(got, p) {
+				t.Fatalf("Expected %+v, got %+v", p, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Did not receive an update like expected")
+		}
+	}
+	if e := <-w.Updates(); e != nil {
+		t.Fatalf("Expected init done marker, got %+v", e)
+	}
+
+	derek := &person{Name: "derek", Age: 22}
+	rev, err := ekv.Create("derek", derek)
+	expectOk(t, err)
+	expectUpdate("derek", derek, false)
+	_, err = ekv.Create("derek", derek)
+	expectErr(t, err)
+
+	derek.Age = 23
+	_, err = ekv.Update("derek", derek, rev)
+	expectOk(t, err)
+	expectUpdate("derek", derek, false)
+
+	// A bad value should not stop the watcher.
+	_, err = kv.PutString("bad", "{not json")
+	expectOk(t, err)
+	expectUpdate("bad", nil, true)
+
+	ivan := &person{Name: "ivan", Age: 33}
+	_, err = ekv.Put("ivan", ivan)
+	expectOk(t, err)
+	expectUpdate("ivan", ivan, false)
+
+	expectOk(t, kv.Delete("ivan"))
+	expectUpdate("ivan", nil, false)
+
+	var p person
+	e, err := ekv.Get("derek", &p)
+	expectOk(t, err)
+	if p != *derek || e.Revision() != 2 {
+		t.Fatalf("Unexpected value %+v at revision %d", p, e.Revision())
+	}
+	_, err = ekv.Get("bad", &p)
+	expectErr(t, err)
+	_, err = ekv.Get("ivan", &p)
+	expectErr(t, err, nats.ErrKeyNotFound)
+}
+
+func TestKeyValueMirrorsAndSources(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "TEST", History: 5})
+	expectOk(t, err)
+	_, err = kv.PutString("name", "derek")
+	expectOk(t, err)
+
+	mkv, err := js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket:  "MIRROR",
+		History: 5,
+		Mirror:  &nats.StreamSource{Name: "TEST"},
+	})
+	expectOk(t, err)
+
+	si, err := js.StreamInfo("KV_MIRROR")
+	expectOk(t, err)
+	if si.Config.Mirror == nil || si.Config.Mirror.Name != "KV_TEST" || len(si.Config.Subjects) != 0 {
+		t.Fatalf("Unexpected mirror config: %+v", si.Config)
+	}
+	// Direct gets are only reported by servers that support them.
+	if si.Config.AllowDirect && !si.Config.MirrorDirect {
+		t.Fatalf("Expected mirror direct to be set: %+v", si.Config)
+	}
+
+	checkMirror := func(mkv nats.KeyValue, key, value string) {
+		t.Helper()
+		checkFor(t, 2*time.Second, 15*time.Millisecond, func() error {
+			e, err := mkv.Get(key)
+			if err != nil {
+				return err
+			}
+			if string(e.Value()) != value {
+				return fmt.Errorf("Expected %q, got %q", value, e.Value())
+			}
+			return nil
+		})
+	}
+	checkMirror(mkv, "name", "derek")
+
+	// Writes to the mirror should go to the origin bucket.
+	_, err = mkv.PutString("age", "22")
+	expectOk(t, err)
+	e, err := kv.Get("age")
+	expectOk(t, err)
+	if string(e.Value()) != "22" {
+		t.Fatalf("Expected %q, got %q", "22", e.Value())
+	}
+
+	// Now bind to the mirror.
+	mkv, err = js.KeyValue("MIRROR")
+	expectOk(t, err)
+	checkMirror(mkv, "age", "22")
+
+	checkKeys := func(kv nats.KeyValue, expected ...string) {
+		t.Helper()
+		keys, err := kv.Keys()
+		expectOk(t, err)
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, expected) {
+			t.Fatalf("Expected keys %v, got %v", expected, keys)
+		}
+	}
+	checkKeys(mkv, "age", "name")
+
+	otherKV, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "OTHER"})
+	expectOk(t, err)
+	_, err = otherKV.PutString("color", "blue")
+	expectOk(t, err)
+	skv, err := js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket:  "SOURCES",
+		Sources: []*nats.StreamSource{{Name: "TEST"}, {Name: "KV_OTHER"}},
+	})
+	if err == nats.ErrKeyValueSourcesNotSupported {
+		// The bucket should not have been created.
+		_, err = js.StreamInfo("KV_SOURCES")
+		expectErr(t, err, nats.ErrStreamNotFound)
+	} else {
+		expectOk(t, err)
+		si, err = js.StreamInfo("KV_SOURCES")
+		expectOk(t, err)
+		if len(si.Config.Subjects) != 1 || si.Config.Subjects[0] != "$KV.SOURCES.>" {
+			t.Fatalf("Unexpected subjects: %+v", si.Config.Subjects)
+		}
+		if len(si.Config.Sources) != 2 || si.Config.Sources[0].Name != "KV_TEST" || si.Config.Sources[1].Name != "KV_OTHER" {
+			t.Fatalf("Unexpected sources: %+v", si.Config.Sources)
+		}
+		// The keys of both buckets are readable in the sourced bucket.
+		checkMirror(skv, "age", "22")
+		checkMirror(skv, "color", "blue")
+		checkKeys(skv, "age", "color", "name")
+	}
+
+	// Reads of the mirror should come from the mirror, not the origin bucket.
+	_, err = kv.PutString("name", "ivan")
+	expectOk(t, err)
+	checkMirror(mkv, "name", "ivan")
+	hist, err := mkv.History("name")
+	expectOk(t, err)
+	if len(hist) != 2 || string(hist[0].Value()) != "derek" || string(hist[1].Value()) != "ivan" {
+		t.Fatalf("Unexpected history: %+v", hist)
+	}
+	w, err := mkv.Watch("age")
+	expectOk(t, err)
+	defer w.Stop()
+	select {
+	case e := <-w.Updates():
+		if e == nil || e.Key() != "age" || string(e.Value()) != "22" {
+			t.Fatalf("Unexpected update: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive the value of the key")
+	}
+	countConsumers := func(stream string) int {
+		var n int
+		for range js.ConsumerNames(stream) {
+			n++
+		}
+		return n
+	}
+	if n := countConsumers("KV_MIRROR"); n != 1 {
+		t.Fatalf("Expected the watcher to consume the mirror, got %d consumers", n)
+	}
+	if n := countConsumers("KV_TEST"); n != 0 {
+		t.Fatalf("Expected no consumers on the origin bucket, got %d", n)
+	}
+}
+
+func TestKeyValueTransforms(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "SECRET"})
+	expectOk(t, err)
+
+	_, err = nats.AESGCMEncryption("k2", map[string][]byte{"k1": make([]byte, 32)})
+	expectErr(t, err, nats.ErrValueKeyNotFound)
+	_, err = nats.AESGCMEncryption("k1", map[string][]byte{"k1": []byte("short")})
+	expectErr(t, err)
+
+	k1, k2 := make([]byte, 32), make([]byte, 16)
+	rand.Read(k1)
+	rand.Read(k2)
+	enc1, err := nats.AESGCMEncryption("k1", map[string][]byte{"k1": k1})
+	expectOk(t, err)
+	skv, err := nats.KeyValueWithTransforms(kv, nats.GzipCompression(), enc1)
+	expectOk(t, err)
+
+	value := strings.Repeat("secret", 100)
+	_, err = skv.PutString("name", value)
+	expectOk(t, err)
+
+	// Check what is stored in the stream.
+	m, err := js.GetLastMsg("KV_SECRET", "$KV.SECRET.name")
+	expectOk(t, err)
+	if strings.Contains(string(m.Data), "secret") {
+		t.Fatalf("Expected value to be encrypted")
+	}
+	if m.Header.Get(nats.ValueCompressionHdr) != "gzip" || m.Header.Get(nats.ValueEncryptionKeyHdr) != "k1" {
+		t.Fatalf("Unexpected headers: %+v", m.Header)
+	}
+
+	// Reading without the transforms should fail.
+	_, err = kv.Get("name")
+	expectErr(t, err, nats.ErrValueTransformMissing)
+
+	e, err := skv.Get("name")
+	expectOk(t, err)
+	if string(e.Value()) != value {
+		t.Fatalf("Unexpected value %q", e.Value())
+	}
+
+	// Rotate the key, older entries should still be readable.
+	enc2, err := nats.AESGCMEncryption("k2", map[string][]byte{"k1": k1, "k2": k2})
+	expectOk(t, err)
+	skv2, err := nats.KeyValueWithTransforms(kv, nats.GzipCompression(), enc2)
+	expectOk(t, err)
+	rev, err := skv2.PutString("age", "22")
+	expectOk(t, err)
+	_, err = skv2.Update("age", []byte("23"), rev)
+	expectOk(t, err)
+	// Values written without transforms are readable too.
+	_, err = kv.PutString("plain", "text")
+	expectOk(t, err)
+
+	w, err := skv2.WatchAll()
+	expectOk(t, err)
+	defer w.Stop()
+	expected := map[string]string{"name": value, "age": "23", "plain": "text"}
+	for e := range w.Updates() {
+		if e == nil {
+			break
+		}
+		if v := expected[e.Key()]; v != string(e.Value()) {
+			t.Fatalf("Expected %q for key %q, got %q", v, e.Key(), e.Value())
+		}
+		delete(expected, e.Key())
+	}
+	if len(expected) != 0 {
+		t.Fatalf("Did not get all keys, missing %+v", expected)
+	}
+
+	// The old key is not known anymore.
+	skv1, err := nats.KeyValueWithTransforms(kv, nats.GzipCompression(), enc1)
+	expectOk(t, err)
+	_, err = skv1.Get("age")
+	expectErr(t, err, nats.ErrValueKeyNotFound)
+
+	// An encrypted value can not be moved to another key.
+	m, err = js.GetLastMsg("KV_SECRET", "$KV.SECRET.name")
+	expectOk(t, err)
+	_, err = js.PublishMsg(&nats.Msg{Subject: "$KV.SECRET.other", Header: m.Header, Data: m.Data})
+	expectOk(t, err)
+	_, err = skv.Get("other")
+	expectErr(t, err)
+
+	// S2 compression, and values that would decompress beyond
+	// the bucket's maximum value size.
+	kv, err = js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "SMALL", MaxValueSize: 1024})
+	expectOk(t, err)
+	zkv, err := nats.KeyValueWithTransforms(kv, nats.S2Compression())
+	expectOk(t, err)
+	_, err = zkv.PutString("name", strings.Repeat("a", 1024))
+	expectOk(t, err)
+	e, err = zkv.Get("name")
+	expectOk(t, err)
+	if string(e.Value()) != strings.Repeat("a", 1024) {
+		t.Fatalf("Unexpected value %q", e.Value())
+	}
+	_, err = zkv.PutString("name", strings.Repeat("a", 1025))
+	expectErr(t, err, nats.ErrValueTooLarge)
+	for _, z := range []nats.ValueTransformer{nats.GzipCompression(), nats.S2Compression()} {
+		hdr := nats.Header{}
+		data, err := z.Encode("bomb", hdr, make([]byte, 4096))
+		expectOk(t, err)
+		_, err = js.PublishMsg(&nats.Msg{Subject: "$KV.SMALL.bomb", Header: hdr, Data: data})
+		expectOk(t, err)
+		zkv, err = nats.KeyValueWithTransforms(kv, z)
+		expectOk(t, err)
+		_, err = zkv.Get("bomb")
+		expectErr(t, err, nats.ErrValueTooLarge)
+	}
+}
+
+func TestKeyValueListing(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	for _, b := range []string{"A", "B", "C"} {
+		kv, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: b, History: 3, Storage: nats.MemoryStorage})
+		expectOk(t, err)
+		_, err = kv.PutString("name", b)
+		expectOk(t, err)
+		_, err = kv.PutString("name", b+b)
+		expectOk(t, err)
+	}
+	_, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "MIRROR", Mirror: &nats.StreamSource{Name: "A"}})
+	expectOk(t, err)
+	// These should not show up.
+	_, err = js.AddStream(&nats.StreamConfig{Name: "FOO", Subjects: []string{"foo"}})
+	expectOk(t, err)
+	_, err = js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "OBJ"})
+	expectOk(t, err)
+
+	var names []string
+	for name := range js.KeyValueStoreNames() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"A", "B", "C", "MIRROR"}) {
+		t.Fatalf("Unexpected bucket names: %v", names)
+	}
+
+	statuses := make(map[string]nats.KeyValueStatus)
+	for status := range js.KeyValueStores() {
+		statuses[status.Bucket()] = status
+	}
+	if len(statuses) != 4 {
+		t.Fatalf("Expected 4 buckets, got %d", len(statuses))
+	}
+	status := statuses["B"]
+	if status.Values() != 2 || status.LastRevision() != 2 || status.Bytes() == 0 {
+		t.Fatalf("Unexpected status: %+v", status)
+	}
+	if status.History() != 3 || status.Replicas() != 1 || status.Storage() != nats.MemoryStorage {
+		t.Fatalf("Unexpected config in status: %+v", status)
+	}
+	if status.Mirror() != nil || len(status.Sources()) != 0 {
+		t.Fatalf("Expected no mirror or sources, got %+v", status)
+	}
+	if m := statuses["MIRROR"].Mirror(); m == nil || m.Name != "KV_A" {
+		t.Fatalf("Expected mirror info, got %+v", m)
+	}
+}
+
 func TestKeyValueBindStore(t *testing.T) {
 	s := RunBasicJetStreamServer()
 	defer shutdownJSServerAndRemoveStorage(t, s)
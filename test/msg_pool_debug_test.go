@@ -0,0 +1,146 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build natsdebug
+// +build natsdebug
+
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func expectPanic(t *testing.T, f func()) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("Expected a panic")
+		}
+	}()
+	f()
+}
+
+func TestPooledMsgsDebugChecks(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL, nats.PooledMsgs())
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	nc.Publish("foo", []byte("hello"))
+	m, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Error on next msg: %v", err)
+	}
+	data := m.Data
+	m.Release()
+	if string(data) == "hello" {
+		t.Fatal("Payload of released message should have been overwritten")
+	}
+	expectPanic(t, m.Release)
+	expectPanic(t, (&nats.Msg{Subject: "foo"}).Release)
+}
+
+func TestPooledMsgsNotForJetStream(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, err := nats.Connect(s.ClientURL(), nats.PooledMsgs())
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := js.Publish("foo", []byte("hello")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sub, err := js.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Error on next msg: %v", err)
+	}
+	// Not from the pool, so still usable for the ack.
+	expectPanic(t, m.Release)
+	if err := m.AckSync(); err != nil {
+		t.Fatalf("Error on ack: %v", err)
+	}
+}
+
+func TestPooledMsgsConflated(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL, nats.PooledMsgs(), nats.ErrorHandler(func(*nats.Conn, *nats.Subscription, error) {}))
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	bch := make(chan struct{})
+	mch := make(chan string, 100)
+	sub, err := nc.Subscribe("price.*", func(m *nats.Msg) {
+		<-bch
+		mch <- m.Subject + "=" + string(m.Data)
+		m.Release()
+	})
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	sub.SetPendingLimits(2, -1)
+	if err := sub.SetOverflowPolicy(nats.OverflowConflate); err != nil {
+		t.Fatalf("Error setting policy: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		nc.Publish("price.a", []byte(fmt.Sprintf("a%d", i)))
+		nc.Publish("price.b", []byte(fmt.Sprintf("b%d", i)))
+	}
+	nc.Flush()
+	close(bch)
+	// The released buffers are overwritten, so the payloads of the
+	// conflated messages must not come from them.
+	for {
+		select {
+		case got := <-mch:
+			var subj string
+			var n int
+			if _, err := fmt.Sscanf(got, "price.%1s=%1s%d", &subj, &subj, &n); err != nil || got != fmt.Sprintf("price.%s=%s%d", subj, subj, n) {
+				t.Fatalf("Unexpected message %q", got)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if stats, _ := sub.OverflowStats(); stats.Conflated == 0 {
+				t.Fatalf("Expected messages to be conflated: %+v", stats)
+			}
+			return
+		}
+	}
+}
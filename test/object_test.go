@@ -14,18 +14,33 @@
 package test
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"text/template"
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/natstest"
 )
 
 func TestObjectBasics(t *testing.T) {
@@ -725,6 +740,1310 @@ func TestObjectList(t *testing.T) {
 	}
 }
 
+func TestObjectTransforms(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "SECRET"})
+	expectOk(t, err)
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	enc, err := nats.AESGCMEncryption("k1", map[string][]byte{"k1": key})
+	expectOk(t, err)
+	sobs, err := nats.ObjectStoreWithTransforms(obs, nats.GzipCompression(), enc)
+	expectOk(t, err)
+
+	blob := bytes.Repeat([]byte("secret"), 100*1024)
+	info, err := sobs.PutBytes("BLOB", blob)
+	expectOk(t, err)
+	if info.Size != uint64(len(blob)) {
+		t.Fatalf("Expected size %d, got %d", len(blob), info.Size)
+	}
+
+	m, err := js.GetLastMsg("OBJ_SECRET", fmt.Sprintf("$O.SECRET.C.%s", info.NUID))
+	expectOk(t, err)
+	if bytes.Contains(m.Data, []byte("secret")) {
+		t.Fatalf("Expected chunk to be encrypted")
+	}
+
+	data, err := sobs.GetBytes("BLOB")
+	expectOk(t, err)
+	if !bytes.Equal(data, blob) {
+		t.Fatalf("Object data does not match")
+	}
+}
+
+func TestObjectStoreListing(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	for _, b := range []string{"A", "B"} {
+		obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: b, Description: b})
+		expectOk(t, err)
+		_, err = obs.PutString("name", b)
+		expectOk(t, err)
+	}
+	_, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "KV"})
+	expectOk(t, err)
+
+	var names []string
+	for name := range js.ObjectStoreNames() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"A", "B"}) {
+		t.Fatalf("Unexpected object store names: %v", names)
+	}
+
+	var count int
+	for status := range js.ObjectStores() {
+		count++
+		if status.Description() != status.Bucket() || status.Size() == 0 {
+			t.Fatalf("Unexpected status: %+v", status)
+		}
+	}
+	if count != 2 {
+		t.Fatalf("Expected 2 object stores, got %d", count)
+	}
+}
+
+type interleavingReader struct {
+	r    io.Reader
+	n    int
+	hook func()
+}
+
+func (ir *interleavingReader) Read(p []byte) (int, error) {
+	if ir.n++; ir.n == 3 {
+		ir.hook()
+	}
+	if len(p) > 1000 {
+		p = p[:1000]
+	}
+	return ir.r.Read(p)
+}
+
+func TestObjectRangedReads(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "RANGES"})
+	expectOk(t, err)
+
+	blob := make([]byte, 25_500)
+	rand.Read(blob)
+
+	// Have chunks of another object stored in between ours, and have the
+	// reader return less than a chunk at a time.
+	r := &interleavingReader{r: bytes.NewReader(blob), hook: func() {
+		_, err := obs.PutBytes("OTHER", bytes.Repeat([]byte("A"), 5000))
+		expectOk(t, err)
+	}}
+	meta := &nats.ObjectMeta{Name: "BLOB", Opts: &nats.ObjectMetaOptions{ChunkSize: 2000}}
+	_, err = obs.Put(meta, r)
+	expectOk(t, err)
+
+	getRange := func(offset, length int64) []byte {
+		t.Helper()
+		res, err := obs.Get("BLOB", nats.ObjectRange(offset, length))
+		expectOk(t, err)
+		defer res.Close()
+		data, err := ioutil.ReadAll(res)
+		expectOk(t, err)
+		return data
+	}
+	for _, rng := range [][2]int64{{0, 10}, {2500, 3000}, {4000, 2000}, {24_000, 0}, {25_499, 100}, {25_500, 0}} {
+		end := rng[0] + rng[1]
+		if rng[1] == 0 || end > int64(len(blob)) {
+			end = int64(len(blob))
+		}
+		if data := getRange(rng[0], rng[1]); !bytes.Equal(data, blob[rng[0]:end]) {
+			t.Fatalf("Unexpected data for range %v", rng)
+		}
+	}
+	_, err = obs.Get("BLOB", nats.ObjectRange(30_000, 0))
+	expectErr(t, err, nats.ErrInvalidObjectRange)
+
+	res, err := obs.Get("BLOB")
+	expectOk(t, err)
+	defer res.Close()
+
+	p := make([]byte, 1000)
+	_, err = io.ReadFull(res, p)
+	expectOk(t, err)
+	pos, err := res.Seek(10_000, io.SeekStart)
+	expectOk(t, err)
+	if pos != 10_000 {
+		t.Fatalf("Unexpected position: %d", pos)
+	}
+	_, err = io.ReadFull(res, p)
+	expectOk(t, err)
+	if !bytes.Equal(p, blob[10_000:11_000]) {
+		t.Fatalf("Unexpected data after seek")
+	}
+	pos, err = res.Seek(-500, io.SeekEnd)
+	expectOk(t, err)
+	rest, err := ioutil.ReadAll(res)
+	expectOk(t, err)
+	if pos != 25_000 || !bytes.Equal(rest, blob[25_000:]) {
+		t.Fatalf("Unexpected data after seek from end")
+	}
+
+	n, err := res.ReadAt(p, 6_500)
+	expectOk(t, err)
+	if n != len(p) || !bytes.Equal(p, blob[6_500:7_500]) {
+		t.Fatalf("Unexpected data from ReadAt")
+	}
+	n, err = res.ReadAt(p, 25_000)
+	if err != io.EOF || n != 500 || !bytes.Equal(p[:n], blob[25_000:]) {
+		t.Fatalf("Unexpected ReadAt result: %d, %v", n, err)
+	}
+
+	// Reading from the start again verifies the digest.
+	_, err = res.Seek(0, io.SeekStart)
+	expectOk(t, err)
+	all, err := ioutil.ReadAll(res)
+	expectOk(t, err)
+	if !bytes.Equal(all, blob) {
+		t.Fatalf("Unexpected data after seek to start")
+	}
+
+	other, err := obs.GetBytes("OTHER")
+	expectOk(t, err)
+	if !bytes.Equal(other, bytes.Repeat([]byte("A"), 5000)) {
+		t.Fatalf("Unexpected data for interleaved object")
+	}
+
+	// Objects whose chunks do not all have the full size, as written by
+	// other clients, can be read from the start, but not from a position
+	// derived from the chunk size.
+	info := &nats.ObjectInfo{
+		ObjectMeta: nats.ObjectMeta{Name: "SHORT", Opts: &nats.ObjectMetaOptions{ChunkSize: 2000}},
+		Bucket:     "RANGES",
+		NUID:       "SHORTNUID",
+		Size:       5000,
+		Chunks:     3,
+		ModTime:    time.Now().UTC(),
+	}
+	h := sha256.New()
+	for _, n := range []int{2000, 1000, 2000} {
+		chunk := blob[:n]
+		h.Write(chunk)
+		_, err = js.Publish("$O.RANGES.C.SHORTNUID", chunk)
+		expectOk(t, err)
+	}
+	info.Digest = "SHA-256=" + base64.URLEncoding.EncodeToString(h.Sum(nil))
+	data, err := json.Marshal(info)
+	expectOk(t, err)
+	_, err = js.Publish("$O.RANGES.M."+base64.URLEncoding.EncodeToString([]byte("SHORT")), data)
+	expectOk(t, err)
+
+	short, err := obs.GetBytes("SHORT")
+	expectOk(t, err)
+	if !bytes.Equal(short, append(append(blob[:2000:2000], blob[:1000]...), blob[:2000]...)) {
+		t.Fatalf("Unexpected data for object with short chunks")
+	}
+	res, err = obs.Get("SHORT", nats.ObjectRange(4000, 0))
+	expectOk(t, err)
+	defer res.Close()
+	_, err = ioutil.ReadAll(res)
+	expectErr(t, err, nats.ErrBadObjectChunks)
+}
+
+type failingReader struct {
+	r     io.Reader
+	limit int
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	if fr.limit <= 0 {
+		return 0, errors.New("connection reset")
+	}
+	if len(p) > fr.limit {
+		p = p[:fr.limit]
+	}
+	n, err := fr.r.Read(p)
+	fr.limit -= n
+	return n, err
+}
+
+func TestObjectResumableUploads(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "UPLOADS"})
+	expectOk(t, err)
+
+	blob := make([]byte, 25_500)
+	rand.Read(blob)
+	meta := &nats.ObjectMeta{Name: "BLOB", Opts: &nats.ObjectMetaOptions{ChunkSize: 2000}}
+
+	var progress []*nats.ObjectUploadProgress
+	record := nats.UploadProgress(func(p *nats.ObjectUploadProgress) {
+		progress = append(progress, p)
+	})
+
+	// An upload that is not resumable removes what was uploaded.
+	_, err = obs.Put(meta, &failingReader{r: bytes.NewReader(blob), limit: 9000}, record)
+	expectErr(t, err)
+	if len(progress) != 4 {
+		t.Fatalf("Expected progress for 4 chunks, got %d", len(progress))
+	}
+	_, err = obs.Put(meta, bytes.NewReader(blob), nats.ResumeUpload(progress[3]))
+	expectErr(t, err, nats.ErrBadUploadProgress)
+
+	// Interrupt a resumable upload.
+	progress = nil
+	_, err = obs.Put(meta, &failingReader{r: bytes.NewReader(blob), limit: 9000}, record, nats.ResumableUpload(), nats.UploadWindow(2))
+	expectErr(t, err)
+	if len(progress) != 4 {
+		t.Fatalf("Expected progress for 4 chunks, got %d", len(progress))
+	}
+	for i, p := range progress {
+		if p.Name != "BLOB" || p.Chunks != uint32(i+1) || p.Size != uint64((i+1)*2000) || p.ChunkSize != 2000 {
+			t.Fatalf("Unexpected progress: %+v", p)
+		}
+	}
+	_, err = obs.GetInfo("BLOB")
+	expectErr(t, err, nats.ErrObjectNotFound)
+
+	// Names must match.
+	_, err = obs.Put(&nats.ObjectMeta{Name: "OTHER"}, bytes.NewReader(blob), nats.ResumeUpload(progress[3]))
+	expectErr(t, err, nats.ErrBadUploadProgress)
+
+	// Resume from an older progress, with a reader that can not seek, the
+	// chunks stored past that progress are skipped.
+	first := progress[0]
+	progress = nil
+	info, err := obs.Put(meta, io.MultiReader(bytes.NewReader(blob)), nats.ResumeUpload(first), record)
+	expectOk(t, err)
+	if info.NUID != first.NUID || info.Chunks != 13 || info.Size != uint64(len(blob)) {
+		t.Fatalf("Unexpected info: %+v", info)
+	}
+	if len(progress) != 9 || progress[8].Chunks != 13 {
+		t.Fatalf("Unexpected progress after resume: %d", len(progress))
+	}
+	data, err := obs.GetBytes("BLOB")
+	expectOk(t, err)
+	if !bytes.Equal(data, blob) {
+		t.Fatalf("Unexpected data after resumed upload")
+	}
+
+	// Replacing the object removes the chunks of the resumed upload.
+	_, err = obs.Put(meta, bytes.NewReader(blob[:5000]), nats.UploadWindow(1))
+	expectOk(t, err)
+	si, err := js.StreamInfo("OBJ_UPLOADS")
+	expectOk(t, err)
+	if si.State.Msgs != 4 {
+		t.Fatalf("Expected 3 chunks and meta, got %d messages", si.State.Msgs)
+	}
+	_, err = obs.Put(meta, bytes.NewReader(blob), nats.UploadWindow(0))
+	expectErr(t, err)
+}
+
+func TestObjectFS(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "ASSETS"})
+	expectOk(t, err)
+
+	files := map[string]string{
+		"index.html":        "<html>{{.}}</html>",
+		"css/site.css":      "body {}",
+		"/img/icons/a.png":  "PNG",
+		"img/b.png":         "PNG2",
+		"templates/a.tmpl":  "{{define \"a\"}}A{{end}}",
+		"templates/b.tmpl":  "{{define \"b\"}}B{{end}}",
+		"removed/gone.html": "gone",
+	}
+	for name, data := range files {
+		_, err = obs.PutString(name, data)
+		expectOk(t, err)
+	}
+	expectOk(t, obs.Delete("removed/gone.html"))
+	site, err := obs.GetInfo("css/site.css")
+	expectOk(t, err)
+	_, err = obs.AddLink("style.css", site)
+	expectOk(t, err)
+
+	fsys, err := nats.NewObjectFS(obs)
+	expectOk(t, err)
+
+	expected := []string{"index.html", "css/site.css", "img/icons/a.png", "img/b.png", "templates/a.tmpl", "templates/b.tmpl", "style.css"}
+	if err := fstest.TestFS(fsys, expected...); err != nil {
+		t.Fatal(err)
+	}
+
+	var walked []string
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		walked = append(walked, path)
+		return err
+	})
+	expectOk(t, err)
+	if want := []string{".", "css", "css/site.css", "img", "img/b.png", "img/icons", "img/icons/a.png", "index.html", "style.css", "templates", "templates/a.tmpl", "templates/b.tmpl"}; !reflect.DeepEqual(walked, want) {
+		t.Fatalf("Unexpected walk: %v", walked)
+	}
+
+	_, err = fsys.Stat("removed/gone.html")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected not exist error, got %v", err)
+	}
+	fi, err := fsys.Stat("style.css")
+	expectOk(t, err)
+	if fi.Size() != int64(len("body {}")) || fi.Sys().(*nats.ObjectInfo).Name != "css/site.css" {
+		t.Fatalf("Unexpected info for link: %+v", fi)
+	}
+
+	tmpl, err := template.ParseFS(fsys, "templates/*.tmpl")
+	expectOk(t, err)
+	if tmpl.Lookup("a") == nil || tmpl.Lookup("b") == nil {
+		t.Fatalf("Expected templates to be parsed")
+	}
+
+	handler, err := nats.NewObjectFileServer(obs)
+	expectOk(t, err)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/css/site.css")
+	expectOk(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	expectOk(t, err)
+	etag := resp.Header.Get("Etag")
+	if resp.StatusCode != http.StatusOK || string(body) != "body {}" || etag != `"`+site.Digest+`"` {
+		t.Fatalf("Unexpected response: %d %q %q", resp.StatusCode, body, etag)
+	}
+	req, err := http.NewRequest("GET", srv.URL+"/css/site.css", nil)
+	expectOk(t, err)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	expectOk(t, err)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("Expected not modified, got %d", resp.StatusCode)
+	}
+	resp, err = http.Get(srv.URL + "/img/")
+	expectOk(t, err)
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	expectOk(t, err)
+	if !strings.Contains(string(body), "b.png") || !strings.Contains(string(body), "icons/") {
+		t.Fatalf("Unexpected directory listing: %s", body)
+	}
+}
+
+func TestObjectVersions(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	_, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "VERSIONS", Versions: -1})
+	expectErr(t, err)
+	_, err = js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "VERSIONS", Versions: 2})
+	expectOk(t, err)
+
+	// The policy applies to handles obtained later.
+	obs, err := js.ObjectStore("VERSIONS")
+	expectOk(t, err)
+
+	var nuids []string
+	for i := 1; i <= 4; i++ {
+		info, err := obs.PutString("A", fmt.Sprintf("version %d", i))
+		expectOk(t, err)
+		nuids = append(nuids, info.NUID)
+	}
+
+	versions, err := obs.Versions("A")
+	expectOk(t, err)
+	if len(versions) != 3 {
+		t.Fatalf("Expected 3 versions, got %d", len(versions))
+	}
+	for i, info := range versions {
+		if info.NUID != nuids[i+1] {
+			t.Fatalf("Unexpected version %d: %+v", i, info)
+		}
+	}
+
+	getVersion := func(nuid string) string {
+		t.Helper()
+		res, err := obs.GetVersion("A", nuid)
+		expectOk(t, err)
+		defer res.Close()
+		data, err := ioutil.ReadAll(res)
+		expectOk(t, err)
+		return string(data)
+	}
+	if data := getVersion(nuids[1]); data != "version 2" {
+		t.Fatalf("Unexpected data: %q", data)
+	}
+	_, err = obs.GetVersion("A", nuids[0])
+	expectErr(t, err, nats.ErrVersionNotFound)
+
+	// The chunks of the first version were removed.
+	si, err := js.StreamInfo("OBJ_VERSIONS", &nats.StreamInfoRequest{SubjectsFilter: "$O.VERSIONS.C.>"})
+	expectOk(t, err)
+	if len(si.State.Subjects) != 3 {
+		t.Fatalf("Expected chunks of 3 versions, got %d", len(si.State.Subjects))
+	}
+
+	// Deleting keeps the previous versions.
+	expectOk(t, obs.Delete("A"))
+	info, err := obs.GetInfo("A")
+	expectOk(t, err)
+	if !info.Deleted {
+		t.Fatalf("Expected object to be deleted")
+	}
+	versions, err = obs.Versions("A")
+	expectOk(t, err)
+	if len(versions) != 3 || !versions[2].Deleted {
+		t.Fatalf("Expected a delete marker as current version")
+	}
+
+	// Restore an old version.
+	info, err = obs.RestoreVersion("A", nuids[2])
+	expectOk(t, err)
+	if info.NUID != nuids[2] || info.Deleted {
+		t.Fatalf("Unexpected restored info: %+v", info)
+	}
+	data, err := obs.GetString("A")
+	expectOk(t, err)
+	if data != "version 3" {
+		t.Fatalf("Unexpected data after restore: %q", data)
+	}
+	versions, err = obs.Versions("A")
+	expectOk(t, err)
+	if len(versions) != 3 || versions[0].NUID != nuids[3] || !versions[1].Deleted {
+		t.Fatalf("Unexpected versions after restore")
+	}
+	if data := getVersion(nuids[3]); data != "version 4" {
+		t.Fatalf("Unexpected data: %q", data)
+	}
+	_, err = obs.RestoreVersion("A", "bad")
+	expectErr(t, err, nats.ErrVersionNotFound)
+
+	// Versions bounded by age.
+	aged, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "AGED", VersionsMaxAge: 250 * time.Millisecond})
+	expectOk(t, err)
+	_, err = aged.PutString("A", "old")
+	expectOk(t, err)
+	_, err = aged.PutString("A", "older")
+	expectOk(t, err)
+	time.Sleep(300 * time.Millisecond)
+	_, err = aged.PutString("A", "new")
+	expectOk(t, err)
+	versions, err = aged.Versions("A")
+	expectOk(t, err)
+	if len(versions) != 1 {
+		t.Fatalf("Expected 1 version, got %d", len(versions))
+	}
+
+	// Buckets without versioning only have the current version.
+	plain, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "PLAIN"})
+	expectOk(t, err)
+	first, err := plain.PutString("A", "1")
+	expectOk(t, err)
+	_, err = plain.PutString("A", "2")
+	expectOk(t, err)
+	versions, err = plain.Versions("A")
+	expectOk(t, err)
+	if len(versions) != 1 {
+		t.Fatalf("Expected 1 version, got %d", len(versions))
+	}
+	_, err = plain.RestoreVersion("A", first.NUID)
+	expectErr(t, err, nats.ErrNotVersioned)
+	_, err = plain.Versions("B")
+	expectErr(t, err, nats.ErrObjectNotFound)
+}
+
+func TestObjectListPages(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "PAGES"})
+	expectOk(t, err)
+
+	for _, name := range []string{"other/x", "dir/sub/d.txt", "a.txt", "dir/c.txt", "f.txt", "dir/b.txt", "e.txt", "gone/g.txt"} {
+		_, err = obs.PutString(name, name)
+		expectOk(t, err)
+	}
+	expectOk(t, obs.Delete("f.txt"))
+	expectOk(t, obs.Delete("gone/g.txt"))
+
+	names := func(l *nats.ObjectListing) []string {
+		var names []string
+		for _, info := range l.Objects {
+			names = append(names, info.Name)
+		}
+		return names
+	}
+
+	l, err := obs.ListObjects()
+	expectOk(t, err)
+	if want := []string{"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "e.txt", "f.txt", "gone/g.txt", "other/x"}; !reflect.DeepEqual(names(l), want) {
+		t.Fatalf("Unexpected objects: %v", names(l))
+	}
+	if !l.Objects[5].Deleted || l.NextCursor != "" {
+		t.Fatalf("Expected deleted object and no cursor")
+	}
+
+	l, err = obs.ListObjects(nats.ListExcludeDeleted(), nats.ListDelimiter("/"))
+	expectOk(t, err)
+	if want := []string{"a.txt", "e.txt"}; !reflect.DeepEqual(names(l), want) {
+		t.Fatalf("Unexpected objects: %v", names(l))
+	}
+	// The prefix of deleted objects only is not listed.
+	if want := []string{"dir/", "other/"}; !reflect.DeepEqual(l.CommonPrefixes, want) {
+		t.Fatalf("Unexpected common prefixes: %v", l.CommonPrefixes)
+	}
+
+	l, err = obs.ListObjects(nats.ListPrefix("dir/"), nats.ListDelimiter("/"))
+	expectOk(t, err)
+	if want := []string{"dir/b.txt", "dir/c.txt"}; !reflect.DeepEqual(names(l), want) || !reflect.DeepEqual(l.CommonPrefixes, []string{"dir/sub/"}) {
+		t.Fatalf("Unexpected listing: %v %v", names(l), l.CommonPrefixes)
+	}
+
+	// Pages with common prefixes.
+	l, err = obs.ListObjects(nats.ListExcludeDeleted(), nats.ListDelimiter("/"), nats.ListLimit(2))
+	expectOk(t, err)
+	if !reflect.DeepEqual(names(l), []string{"a.txt"}) || !reflect.DeepEqual(l.CommonPrefixes, []string{"dir/"}) || l.NextCursor == "" {
+		t.Fatalf("Unexpected first page: %v %v", names(l), l.CommonPrefixes)
+	}
+	l, err = obs.ListObjects(nats.ListExcludeDeleted(), nats.ListDelimiter("/"), nats.ListLimit(2), nats.ListCursor(l.NextCursor))
+	expectOk(t, err)
+	if !reflect.DeepEqual(names(l), []string{"e.txt"}) || !reflect.DeepEqual(l.CommonPrefixes, []string{"other/"}) || l.NextCursor != "" {
+		t.Fatalf("Unexpected second page: %v %v %q", names(l), l.CommonPrefixes, l.NextCursor)
+	}
+
+	// Walk all the pages.
+	var all []string
+	var cursor string
+	for pages := 0; ; pages++ {
+		if pages > 4 {
+			t.Fatalf("Too many pages")
+		}
+		l, err = obs.ListObjects(nats.ListPrefix("dir/"), nats.ListLimit(2), nats.ListCursor(cursor))
+		expectOk(t, err)
+		all = append(all, names(l)...)
+		if cursor = l.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if want := []string{"dir/b.txt", "dir/c.txt", "dir/sub/d.txt"}; !reflect.DeepEqual(all, want) {
+		t.Fatalf("Unexpected objects: %v", all)
+	}
+
+	_, err = obs.ListObjects(nats.ListCursor("!"))
+	expectErr(t, err, nats.ErrBadListCursor)
+	_, err = obs.ListObjects(nats.ListLimit(-1))
+	expectErr(t, err)
+
+	empty, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "EMPTY"})
+	expectOk(t, err)
+	l, err = empty.ListObjects()
+	expectOk(t, err)
+	if len(l.Objects) != 0 {
+		t.Fatalf("Expected no objects")
+	}
+}
+
+func TestObjectListManyPages(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "MANY"})
+	expectOk(t, err)
+
+	// Objects at the top and in directories, every third one deleted.
+	var live, liveTop []string
+	liveDirs := make(map[string]bool)
+	for i := 0; i < 60; i++ {
+		name := fmt.Sprintf("obj-%02d", i)
+		if i%2 == 1 {
+			name = fmt.Sprintf("dir-%02d/obj-%02d", i/10, i)
+		}
+		_, err := obs.PutString(name, name)
+		expectOk(t, err)
+		if i%3 == 0 {
+			expectOk(t, obs.Delete(name))
+			continue
+		}
+		live = append(live, name)
+		if i%2 == 1 {
+			liveDirs[fmt.Sprintf("dir-%02d/", i/10)] = true
+		} else {
+			liveTop = append(liveTop, name)
+		}
+	}
+	sort.Strings(live)
+
+	walk := func(opts ...nats.ListObjectsOpt) ([]string, []string, int) {
+		t.Helper()
+		var objects, prefixes []string
+		var cursor string
+		for pages := 1; ; pages++ {
+			if pages > 100 {
+				t.Fatalf("Too many pages")
+			}
+			l, err := obs.ListObjects(append(opts, nats.ListLimit(7), nats.ListCursor(cursor))...)
+			expectOk(t, err)
+			if n := len(l.Objects) + len(l.CommonPrefixes); n > 7 || (n < 7 && l.NextCursor != "") {
+				t.Fatalf("Unexpected page of %d entries, cursor %q", n, l.NextCursor)
+			}
+			for _, info := range l.Objects {
+				objects = append(objects, info.Name)
+			}
+			prefixes = append(prefixes, l.CommonPrefixes...)
+			if cursor = l.NextCursor; cursor == "" {
+				return objects, prefixes, pages
+			}
+		}
+	}
+
+	objects, _, pages := walk(nats.ListExcludeDeleted())
+	if !reflect.DeepEqual(objects, live) {
+		t.Fatalf("Unexpected objects: %v", objects)
+	}
+	if want := (len(live) + 6) / 7; pages != want {
+		t.Fatalf("Expected %d pages, got %d", want, pages)
+	}
+
+	objects, _, _ = walk()
+	if len(objects) != 60 {
+		t.Fatalf("Expected all the objects, got %d", len(objects))
+	}
+
+	objects, prefixes, _ := walk(nats.ListExcludeDeleted(), nats.ListDelimiter("/"))
+	sort.Strings(liveTop)
+	var dirs []string
+	for dir := range liveDirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	if !reflect.DeepEqual(objects, liveTop) || !reflect.DeepEqual(prefixes, dirs) {
+		t.Fatalf("Unexpected listing: %v %v", objects, prefixes)
+	}
+}
+
+func TestObjectAudit(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "AUDIT"})
+	expectOk(t, err)
+
+	blob := make([]byte, 5000)
+	rand.Read(blob)
+	meta := func(name string) *nats.ObjectMeta {
+		return &nats.ObjectMeta{Name: name, Opts: &nats.ObjectMetaOptions{ChunkSize: 1000}}
+	}
+	a, err := obs.Put(meta("A"), bytes.NewReader(blob))
+	expectOk(t, err)
+	b, err := obs.Put(meta("B"), bytes.NewReader(blob))
+	expectOk(t, err)
+	_, err = obs.AddLink("L", a)
+	expectOk(t, err)
+	_, err = obs.PutString("D", "deleted")
+	expectOk(t, err)
+	expectOk(t, obs.Delete("D"))
+
+	report, err := obs.Audit(nats.AuditVerifyData())
+	expectOk(t, err)
+	if report.Objects != 3 || len(report.Orphans) != 0 || len(report.Issues) != 0 {
+		t.Fatalf("Unexpected report for a clean bucket: %+v", report)
+	}
+
+	// Leave an interrupted upload.
+	var progress *nats.ObjectUploadProgress
+	_, err = obs.Put(meta("C"), &failingReader{r: bytes.NewReader(blob), limit: 2500}, nats.ResumableUpload(),
+		nats.UploadProgress(func(p *nats.ObjectUploadProgress) { progress = p }))
+	expectErr(t, err)
+
+	// Remove a chunk of B and add one to A.
+	m, err := js.GetLastMsg("OBJ_AUDIT", "$O.AUDIT.C."+b.NUID)
+	expectOk(t, err)
+	expectOk(t, js.DeleteMsg("OBJ_AUDIT", m.Sequence))
+	_, err = js.Publish("$O.AUDIT.C."+a.NUID, []byte("extra"))
+	expectOk(t, err)
+
+	report, err = obs.Audit()
+	expectOk(t, err)
+	if len(report.Orphans) != 1 || report.Orphans[0].NUID != progress.NUID || report.Orphans[0].Chunks != 2 || report.Orphans[0].Purged {
+		t.Fatalf("Unexpected orphans: %+v", report.Orphans)
+	}
+	kinds := func(r *nats.ObjectAuditReport) []string {
+		var kinds []string
+		for _, issue := range r.Issues {
+			kinds = append(kinds, issue.Name+":"+issue.Kind.String())
+		}
+		return kinds
+	}
+	if want := []string{"A:ExtraChunks", "B:MissingChunks"}; !reflect.DeepEqual(kinds(report), want) {
+		t.Fatalf("Unexpected issues: %v", kinds(report))
+	}
+	report, err = obs.Audit(nats.AuditVerifyData())
+	expectOk(t, err)
+	want := []string{"A:ExtraChunks", "A:SizeMismatch", "A:DigestMismatch", "B:MissingChunks", "B:SizeMismatch", "B:DigestMismatch"}
+	if !reflect.DeepEqual(kinds(report), want) {
+		t.Fatalf("Unexpected issues: %v", kinds(report))
+	}
+
+	// Recent orphans are kept.
+	report, err = obs.Audit(nats.AuditPurgeOrphans(time.Hour))
+	expectOk(t, err)
+	if len(report.Orphans) != 1 || report.Orphans[0].Purged {
+		t.Fatalf("Expected orphan not to be purged")
+	}
+	report, err = obs.Audit(nats.AuditPurgeOrphans(0))
+	expectOk(t, err)
+	if len(report.Orphans) != 1 || !report.Orphans[0].Purged {
+		t.Fatalf("Expected orphan to be purged")
+	}
+	report, err = obs.Audit()
+	expectOk(t, err)
+	if len(report.Orphans) != 0 {
+		t.Fatalf("Unexpected orphans after purge: %+v", report.Orphans)
+	}
+
+	// Chunks referenced by a meta whose name can not be decoded are not
+	// orphans, and meta that can not be read fails the audit.
+	_, err = js.Publish("$O.AUDIT.C.ODDNUID", []byte("odd"))
+	expectOk(t, err)
+	odd, err := json.Marshal(&nats.ObjectInfo{ObjectMeta: nats.ObjectMeta{Name: "odd"}, Bucket: "AUDIT", NUID: "ODDNUID", Size: 3, Chunks: 1})
+	expectOk(t, err)
+	_, err = js.Publish("$O.AUDIT.M.!odd", odd)
+	expectOk(t, err)
+	report, err = obs.Audit(nats.AuditPurgeOrphans(0))
+	expectOk(t, err)
+	if len(report.Orphans) != 0 {
+		t.Fatalf("Unexpected orphans: %+v", report.Orphans)
+	}
+	_, err = js.Publish("$O.AUDIT.M.!odd", []byte("not json"))
+	expectOk(t, err)
+	_, err = obs.Audit(nats.AuditPurgeOrphans(0))
+	expectErr(t, err, nats.ErrBadObjectMeta)
+	_, err = js.GetLastMsg("OBJ_AUDIT", "$O.AUDIT.C.ODDNUID")
+	expectOk(t, err)
+}
+
+func TestObjectPutWriter(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "WRITER"})
+	expectOk(t, err)
+
+	blob := make([]byte, 10_500)
+	rand.Read(blob)
+	meta := func(name string) *nats.ObjectMeta {
+		return &nats.ObjectMeta{Name: name, Opts: &nats.ObjectMetaOptions{ChunkSize: 1000}}
+	}
+
+	var progress int
+	w, err := obs.PutWriter(meta("W"), nats.UploadProgress(func(*nats.ObjectUploadProgress) { progress++ }))
+	expectOk(t, err)
+	// Writes of various sizes, spanning chunks.
+	for _, n := range []int{1, 999, 1500, 3000, 5000} {
+		_, err = w.Write(blob[:n])
+		expectOk(t, err)
+		blob = blob[n:]
+	}
+	if w.Info() != nil {
+		t.Fatalf("Expected no info before close")
+	}
+	expectOk(t, w.Close())
+	expectOk(t, w.Close())
+	info := w.Info()
+	if info == nil || info.Size != 10_500 || info.Chunks != 11 || progress != 11 {
+		t.Fatalf("Unexpected info: %+v, progress %d", info, progress)
+	}
+	_, err = w.Write([]byte("more"))
+	expectErr(t, err, nats.ErrObjectWriterClosed)
+	expectErr(t, w.Abort(), nats.ErrObjectWriterClosed)
+
+	// Same chunking and digest than Put.
+	data, err := obs.GetBytes("W")
+	expectOk(t, err)
+	pinfo, err := obs.Put(meta("P"), bytes.NewReader(data))
+	expectOk(t, err)
+	if pinfo.Digest != info.Digest || pinfo.Chunks != info.Chunks {
+		t.Fatalf("Expected same digest and chunks than Put")
+	}
+	// Put without a reader records no digest.
+	pinfo, err = obs.Put(meta("N"), nil)
+	expectOk(t, err)
+	if pinfo.Digest != "" {
+		t.Fatalf("Unexpected digest without data: %q", pinfo.Digest)
+	}
+
+	// Use with writers producing the data.
+	w, err = obs.PutWriter(&nats.ObjectMeta{Name: "data.json.gz"})
+	expectOk(t, err)
+	zw := gzip.NewWriter(w)
+	expectOk(t, json.NewEncoder(zw).Encode(map[string]string{"hello": "world"}))
+	expectOk(t, zw.Close())
+	expectOk(t, w.Close())
+	res, err := obs.Get("data.json.gz")
+	expectOk(t, err)
+	zr, err := gzip.NewReader(res)
+	expectOk(t, err)
+	var v map[string]string
+	expectOk(t, json.NewDecoder(zr).Decode(&v))
+	res.Close()
+	if v["hello"] != "world" {
+		t.Fatalf("Unexpected value: %v", v)
+	}
+
+	// An empty object.
+	w, err = obs.PutWriter(&nats.ObjectMeta{Name: "empty"})
+	expectOk(t, err)
+	expectOk(t, w.Close())
+	if w.Info().Size != 0 || w.Info().Chunks != 0 {
+		t.Fatalf("Unexpected info: %+v", w.Info())
+	}
+
+	// Aborting removes the chunks.
+	w, err = obs.PutWriter(meta("A"))
+	expectOk(t, err)
+	_, err = w.Write(data[:5000])
+	expectOk(t, err)
+	expectOk(t, w.Abort())
+	_, err = w.Write(data[:10])
+	expectErr(t, err, nats.ErrObjectWriterClosed)
+	expectErr(t, w.Close(), nats.ErrObjectWriterClosed)
+	_, err = obs.GetInfo("A")
+	expectErr(t, err, nats.ErrObjectNotFound)
+	report, err := obs.Audit()
+	expectOk(t, err)
+	if len(report.Orphans) != 0 {
+		t.Fatalf("Expected aborted chunks to be purged")
+	}
+
+	_, err = obs.PutWriter(meta("R"), nats.ResumeUpload(&nats.ObjectUploadProgress{Name: "R", NUID: "x", ChunkSize: 1000}))
+	expectErr(t, err)
+}
+
+func TestObjectReap(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "REAP"})
+	expectOk(t, err)
+
+	put := func(name string, expires *time.Time) {
+		t.Helper()
+		_, err := obs.Put(&nats.ObjectMeta{Name: name, Expires: expires}, bytes.NewReader([]byte(name)))
+		expectOk(t, err)
+	}
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	put("expired", &past)
+	put("later", &future)
+	put("tmp/old", nil)
+	time.Sleep(100 * time.Millisecond)
+	for i := 1; i <= 4; i++ {
+		put(fmt.Sprintf("logs/%d", i), nil)
+	}
+	put("tmp/new", nil)
+
+	// Expiry can be set on existing objects.
+	put("keep", nil)
+	expectOk(t, obs.UpdateMeta("keep", &nats.ObjectMeta{Name: "keep", Expires: &future}))
+	info, err := obs.GetInfo("keep")
+	expectOk(t, err)
+	if info.Expires == nil || !info.Expires.Equal(future) {
+		t.Fatalf("Unexpected expiry: %v", info.Expires)
+	}
+
+	_, err = obs.Reap(&nats.ObjectRetentionRule{KeepLast: -1})
+	expectErr(t, err)
+
+	deleted, err := obs.Reap(
+		&nats.ObjectRetentionRule{Prefix: "logs/", KeepLast: 2},
+		&nats.ObjectRetentionRule{Prefix: "tmp/", MaxAge: 50 * time.Millisecond},
+	)
+	expectOk(t, err)
+	var names []string
+	for _, info := range deleted {
+		names = append(names, info.Name)
+	}
+	if want := []string{"expired", "logs/1", "logs/2", "tmp/old"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("Unexpected deleted objects: %v", names)
+	}
+	for _, name := range names {
+		info, err := obs.GetInfo(name)
+		expectOk(t, err)
+		if !info.Deleted {
+			t.Fatalf("Expected %q to be deleted", name)
+		}
+	}
+	report, err := obs.Audit()
+	expectOk(t, err)
+	if len(report.Orphans) != 0 || report.Objects != 5 {
+		t.Fatalf("Unexpected audit after reap: %+v", report)
+	}
+
+	// Nothing left to reap.
+	deleted, err = obs.Reap(&nats.ObjectRetentionRule{Prefix: "logs/", KeepLast: 2})
+	expectOk(t, err)
+	if len(deleted) != 0 {
+		t.Fatalf("Unexpected deleted objects: %d", len(deleted))
+	}
+
+	reaper, err := obs.StartReaper(20 * time.Millisecond)
+	expectOk(t, err)
+	defer reaper.Stop()
+	soon := time.Now().Add(100 * time.Millisecond)
+	put("soon", &soon)
+	checkFor(t, 2*time.Second, 20*time.Millisecond, func() error {
+		info, err := obs.GetInfo("soon")
+		if err != nil {
+			return err
+		}
+		if !info.Deleted {
+			return fmt.Errorf("not reaped yet")
+		}
+		return nil
+	})
+	reaper.Stop()
+	reaper.Stop()
+
+	// The reaper follows the clock of the connection.
+	clock := natstest.NewFakeClock(time.Now())
+	fnc, err := nats.Connect(s.ClientURL(), nats.SetClock(clock), nats.PingInterval(24*time.Hour))
+	expectOk(t, err)
+	defer fnc.Close()
+	fjs, err := fnc.JetStream()
+	expectOk(t, err)
+	fobs, err := fjs.ObjectStore("REAP")
+	expectOk(t, err)
+	later := clock.Now().Add(time.Hour)
+	put("later2", &later)
+	freaper, err := fobs.StartReaper(2 * time.Hour)
+	expectOk(t, err)
+	defer freaper.Stop()
+	time.Sleep(50 * time.Millisecond)
+	if info, err := obs.GetInfo("later2"); err != nil || info.Deleted {
+		t.Fatalf("Unexpected reap before the clock is advanced: %v %v", info, err)
+	}
+	clock.Advance(2 * time.Hour)
+	checkFor(t, 2*time.Second, 20*time.Millisecond, func() error {
+		info, err := obs.GetInfo("later2")
+		if err != nil {
+			return err
+		}
+		if !info.Deleted {
+			return fmt.Errorf("not reaped yet")
+		}
+		return nil
+	})
+}
+
+func TestObjectSync(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "SYNC"})
+	expectOk(t, err)
+
+	src := t.TempDir()
+	writeFile := func(dir, name, data string) {
+		t.Helper()
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		expectOk(t, os.MkdirAll(filepath.Dir(file), 0755))
+		expectOk(t, ioutil.WriteFile(file, []byte(data), 0644))
+	}
+	writeFile(src, "a.txt", "A")
+	writeFile(src, "sub/b.txt", "B")
+
+	report, err := obs.UploadDir(src, nats.SyncPrefix("site/"))
+	expectOk(t, err)
+	if want := []string{"site/a.txt", "site/sub/b.txt"}; !reflect.DeepEqual(report.Transferred, want) {
+		t.Fatalf("Unexpected upload: %+v", report)
+	}
+	report, err = obs.UploadDir(src, nats.SyncPrefix("site/"))
+	expectOk(t, err)
+	if len(report.Transferred) != 0 || len(report.Unchanged) != 2 {
+		t.Fatalf("Unexpected upload: %+v", report)
+	}
+
+	// Changed files keep the meta data of the object.
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	expectOk(t, obs.UpdateMeta("site/sub/b.txt", &nats.ObjectMeta{Name: "site/sub/b.txt", Description: "bee", Headers: nats.Header{"X": []string{"y"}}, Expires: &expires}))
+	writeFile(src, "sub/b.txt", "BB")
+	_, err = obs.PutString("site/old.txt", "old")
+	expectOk(t, err)
+	_, err = obs.PutString("other.txt", "other")
+	expectOk(t, err)
+	report, err = obs.UploadDir(src, nats.SyncPrefix("site/"), nats.SyncDelete())
+	expectOk(t, err)
+	if !reflect.DeepEqual(report.Transferred, []string{"site/sub/b.txt"}) || !reflect.DeepEqual(report.Deleted, []string{"site/old.txt"}) {
+		t.Fatalf("Unexpected upload: %+v", report)
+	}
+	info, err := obs.GetInfo("site/sub/b.txt")
+	expectOk(t, err)
+	if info.Description != "bee" || info.Headers.Get("X") != "y" || info.Size != 2 || info.Expires == nil || !info.Expires.Equal(expires) {
+		t.Fatalf("Unexpected info: %+v", info)
+	}
+
+	dst := t.TempDir()
+	writeFile(dst, "a.txt", "stale content")
+	writeFile(dst, "stray/c.txt", "C")
+	report, err = obs.DownloadDir(dst, nats.SyncPrefix("site/"))
+	expectOk(t, err)
+	if len(report.Transferred) != 2 || len(report.Deleted) != 0 {
+		t.Fatalf("Unexpected download: %+v", report)
+	}
+	for name, want := range map[string]string{"a.txt": "A", "sub/b.txt": "BB", "stray/c.txt": "C"} {
+		data, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		expectOk(t, err)
+		if string(data) != want {
+			t.Fatalf("Unexpected content for %q: %q", name, data)
+		}
+	}
+	report, err = obs.DownloadDir(dst, nats.SyncPrefix("site/"), nats.SyncDelete())
+	expectOk(t, err)
+	if len(report.Unchanged) != 2 || !reflect.DeepEqual(report.Deleted, []string{"site/stray/c.txt"}) {
+		t.Fatalf("Unexpected download: %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "stray", "c.txt")); !os.IsNotExist(err) {
+		t.Fatalf("Expected stray file to be deleted")
+	}
+
+	// Names outside of the directory are not downloaded.
+	_, err = obs.PutString("site/../escape.txt", "no")
+	expectOk(t, err)
+	_, err = obs.PutString("site//abs.txt", "no")
+	expectOk(t, err)
+	report, err = obs.DownloadDir(dst, nats.SyncPrefix("site/"))
+	expectOk(t, err)
+	if len(report.Transferred) != 0 || !reflect.DeepEqual(report.Skipped, []string{"site/../escape.txt", "site//abs.txt"}) {
+		t.Fatalf("Unexpected download: %+v", report)
+	}
+	expectOk(t, obs.Delete("site/../escape.txt"))
+	expectOk(t, obs.Delete("site//abs.txt"))
+
+	// Export and import as a tar archive.
+	var buf bytes.Buffer
+	expectOk(t, obs.ExportTar(&buf, nats.SyncPrefix("site/")))
+	other, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "IMPORT"})
+	expectOk(t, err)
+	_, err = other.PutString("copy/extra", "extra")
+	expectOk(t, err)
+	report, err = other.ImportTar(bytes.NewReader(buf.Bytes()), nats.SyncPrefix("copy/"), nats.SyncDelete())
+	expectOk(t, err)
+	if want := []string{"copy/a.txt", "copy/sub/b.txt"}; !reflect.DeepEqual(report.Transferred, want) || !reflect.DeepEqual(report.Deleted, []string{"copy/extra"}) {
+		t.Fatalf("Unexpected import: %+v", report)
+	}
+	info, err = other.GetInfo("copy/sub/b.txt")
+	expectOk(t, err)
+	if info.Description != "bee" || info.Headers.Get("X") != "y" {
+		t.Fatalf("Unexpected imported info: %+v", info)
+	}
+	data, err := other.GetString("copy/sub/b.txt")
+	expectOk(t, err)
+	if data != "BB" {
+		t.Fatalf("Unexpected imported content: %q", data)
+	}
+
+	// Files that do not match their digest are not imported.
+	buf.Reset()
+	tw := tar.NewWriter(&buf)
+	expectOk(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "a.txt", Size: 3, Mode: 0644, Format: tar.FormatPAX,
+		PAXRecords: map[string]string{"NATS.digest": info.Digest}}))
+	_, err = tw.Write([]byte("bad"))
+	expectOk(t, err)
+	expectOk(t, tw.Close())
+	_, err = other.ImportTar(&buf, nats.SyncPrefix("copy/"))
+	expectErr(t, err, nats.ErrDigestMismatch)
+	data, err = other.GetString("copy/a.txt")
+	expectOk(t, err)
+	if data != "A" {
+		t.Fatalf("Unexpected content after failed import: %q", data)
+	}
+}
+
+func TestObjectWatchEvents(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+
+	obs, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "EVENTS"})
+	expectOk(t, err)
+
+	_, err = obs.PutString("docs/a", "A")
+	expectOk(t, err)
+	_, err = obs.PutString("other", "O")
+	expectOk(t, err)
+
+	_, err = obs.WatchEvents(nats.WatchNames("[bad"))
+	expectErr(t, err)
+
+	next := func(ch <-chan *nats.ObjectEvent) *nats.ObjectEvent {
+		t.Helper()
+		select {
+		case ev := <-ch:
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Did not receive event")
+		}
+		return nil
+	}
+	expectEvent := func(ch <-chan *nats.ObjectEvent, op nats.ObjectOp, name string) *nats.ObjectEvent {
+		t.Helper()
+		ev := next(ch)
+		if ev == nil || ev.Op != op || ev.Info.Name != name {
+			t.Fatalf("Expected %v for %q, got %+v", op, name, ev)
+		}
+		return ev
+	}
+	expectMarker := func(ch <-chan *nats.ObjectEvent) {
+		t.Helper()
+		if ev := next(ch); ev != nil {
+			t.Fatalf("Expected initial values marker, got %+v", ev)
+		}
+	}
+
+	w, err := obs.WatchEvents(nats.WatchNames("docs/*"))
+	expectOk(t, err)
+	defer w.Stop()
+	expectEvent(w.Events(), nats.ObjectOpPut, "docs/a")
+	expectMarker(w.Events())
+
+	_, err = obs.PutString("docs/b", "B")
+	expectOk(t, err)
+	expectEvent(w.Events(), nats.ObjectOpPut, "docs/b")
+	expectOk(t, obs.UpdateMeta("docs/b", &nats.ObjectMeta{Name: "docs/b", Description: "bee"}))
+	ev := expectEvent(w.Events(), nats.ObjectOpUpdateMeta, "docs/b")
+	if ev.Info.Description != "bee" {
+		t.Fatalf("Unexpected info: %+v", ev.Info)
+	}
+	resumeAt := ev.Sequence + 1
+	expectOk(t, obs.UpdateMeta("docs/b", &nats.ObjectMeta{Name: "docs/c"}))
+	expectEvent(w.Events(), nats.ObjectOpUpdateMeta, "docs/c")
+	_, err = obs.PutString("other", "O2")
+	expectOk(t, err)
+	a, err := obs.GetInfo("docs/a")
+	expectOk(t, err)
+	_, err = obs.AddLink("docs/l", a)
+	expectOk(t, err)
+	expectEvent(w.Events(), nats.ObjectOpLink, "docs/l")
+	expectOk(t, obs.Delete("docs/a"))
+	expectEvent(w.Events(), nats.ObjectOpDelete, "docs/a")
+	_, err = obs.PutString("docs/a", "A2")
+	expectOk(t, err)
+	expectEvent(w.Events(), nats.ObjectOpPut, "docs/a")
+
+	// Resume after a change, without the deletes.
+	rw, err := obs.WatchEvents(nats.WatchNames("docs/*"), nats.ResumeFromRevision(resumeAt), nats.IgnoreDeletes())
+	expectOk(t, err)
+	defer rw.Stop()
+	expectEvent(rw.Events(), nats.ObjectOpPut, "docs/c")
+	expectEvent(rw.Events(), nats.ObjectOpLink, "docs/l")
+	expectEvent(rw.Events(), nats.ObjectOpPut, "docs/a")
+	expectMarker(rw.Events())
+
+	// Updates with name filtering.
+	uw, err := obs.Watch(nats.WatchNames("other", "docs/c"))
+	expectOk(t, err)
+	defer uw.Stop()
+	var names []string
+	for info := range uw.Updates() {
+		if info == nil {
+			break
+		}
+		names = append(names, info.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"docs/c", "other"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("Unexpected updates: %v", names)
+	}
+
+	// Objects renamed to a matching name are seen as renamed.
+	expectOk(t, obs.UpdateMeta("other", &nats.ObjectMeta{Name: "docs/o"}))
+	ev = expectEvent(w.Events(), nats.ObjectOpUpdateMeta, "docs/o")
+	expectErr(t, ev.CommitRevision(), nats.ErrNoRevisionStore)
+
+	// Stopping closes the channel.
+	expectOk(t, w.Stop())
+	select {
+	case _, ok := <-w.Events():
+		if ok {
+			t.Fatalf("Expected channel to be closed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Channel was not closed")
+	}
+
+	// Persisted revisions are committed by the application.
+	store := nats.FileRevisionStore(filepath.Join(t.TempDir(), "rev"))
+	_, err = obs.Watch(nats.PersistRevision(store))
+	expectErr(t, err, nats.ErrObjectWatchRevision)
+	pw, err := obs.WatchEvents(nats.WatchNames("docs/*"), nats.PersistRevision(store))
+	expectOk(t, err)
+	ev = next(pw.Events())
+	expectOk(t, ev.CommitRevision())
+	ev = next(pw.Events())
+	expectOk(t, pw.Stop())
+	pw, err = obs.WatchEvents(nats.WatchNames("docs/*"), nats.PersistRevision(store))
+	expectOk(t, err)
+	defer pw.Stop()
+	if rev := next(pw.Events()); rev == nil || rev.Sequence != ev.Sequence {
+		t.Fatalf("Expected to resume at %d, got %+v", ev.Sequence, rev)
+	}
+
+	// Empty bucket.
+	empty, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "NOEVENTS"})
+	expectOk(t, err)
+	ew, err := empty.WatchEvents()
+	expectOk(t, err)
+	defer ew.Stop()
+	expectMarker(ew.Events())
+
+	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "KV"})
+	expectOk(t, err)
+	_, err = kv.WatchAll(nats.WatchNames("*"))
+	expectErr(t, err)
+}
+
 func TestObjectMaxBytes(t *testing.T) {
 	s := RunBasicJetStreamServer()
 	defer shutdownJSServerAndRemoveStorage(t, s)
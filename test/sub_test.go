@@ -1571,3 +1571,323 @@ func TestAutoUnsubOnSyncSubCanStillRespond(t *testing.T) {
 		t.Fatalf("Error responding: %v", err)
 	}
 }
+
+func TestSubscriptionOverflowPolicies(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc := NewDefaultConnection(t)
+	defer nc.Close()
+
+	// Override default handler for test.
+	nc.SetErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, _ error) {})
+
+	t.Run("errors", func(t *testing.T) {
+		ch := make(chan *nats.Msg, 10)
+		csub, err := nc.ChanSubscribe("foo", ch)
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer csub.Unsubscribe()
+		if err := csub.SetOverflowPolicy(nats.OverflowDropOldest); err != nats.ErrTypeSubscription {
+			t.Fatalf("Expected %v, got %v", nats.ErrTypeSubscription, err)
+		}
+		ssub, err := nc.SubscribeSync("foo")
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer ssub.Unsubscribe()
+		if err := ssub.SetOverflowPolicy(nats.OverflowConflate); err != nats.ErrTypeSubscription {
+			t.Fatalf("Expected %v, got %v", nats.ErrTypeSubscription, err)
+		}
+		if err := ssub.SetOverflowPolicy(nats.OverflowPolicy(42)); err != nats.ErrInvalidArg {
+			t.Fatalf("Expected %v, got %v", nats.ErrInvalidArg, err)
+		}
+		if err := ssub.SetOverflowSpill(t.TempDir(), 0); err != nats.ErrInvalidArg {
+			t.Fatalf("Expected %v, got %v", nats.ErrInvalidArg, err)
+		}
+		ssub.Unsubscribe()
+		if err := ssub.SetOverflowPolicy(nats.OverflowDropOldest); err != nats.ErrBadSubscription {
+			t.Fatalf("Expected %v, got %v", nats.ErrBadSubscription, err)
+		}
+	})
+
+	t.Run("drop oldest sync", func(t *testing.T) {
+		sub, err := nc.SubscribeSync("sync")
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+		sub.SetPendingLimits(5, -1)
+		if err := sub.SetOverflowPolicy(nats.OverflowDropOldest); err != nil {
+			t.Fatalf("Error setting policy: %v", err)
+		}
+		if p, _ := sub.OverflowPolicy(); p != nats.OverflowDropOldest {
+			t.Fatalf("Unexpected policy: %v", p)
+		}
+		for i := 0; i < 20; i++ {
+			nc.Publish("sync", []byte(fmt.Sprintf("%d", i)))
+		}
+		nc.Flush()
+		for i := 15; i < 20; i++ {
+			m, err := sub.NextMsg(time.Second)
+			if err != nil {
+				t.Fatalf("Error on next msg: %v", err)
+			}
+			if string(m.Data) != fmt.Sprintf("%d", i) {
+				t.Fatalf("Expected %d, got %s", i, m.Data)
+			}
+		}
+		stats, _ := sub.OverflowStats()
+		if stats.DroppedOldest != 15 || stats.DroppedNewest != 0 {
+			t.Fatalf("Unexpected stats: %+v", stats)
+		}
+		if dropped, _ := sub.Dropped(); dropped != 15 {
+			t.Fatalf("Expected 15 dropped, got %d", dropped)
+		}
+	})
+
+	t.Run("drop oldest async", func(t *testing.T) {
+		bch := make(chan struct{})
+		mch := make(chan string, 20)
+		sub, err := nc.Subscribe("async", func(m *nats.Msg) {
+			<-bch
+			mch <- string(m.Data)
+		})
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+		sub.SetPendingLimits(5, -1)
+		sub.SetOverflowPolicy(nats.OverflowDropOldest)
+		for i := 0; i < 20; i++ {
+			nc.Publish("async", []byte(fmt.Sprintf("%d", i)))
+		}
+		nc.Flush()
+		close(bch)
+		stats, _ := sub.OverflowStats()
+		if stats.DroppedOldest < 14 || stats.DroppedNewest != 0 {
+			t.Fatalf("Unexpected stats: %+v", stats)
+		}
+		var last string
+		for i := 0; i < 20-int(stats.DroppedOldest); i++ {
+			select {
+			case last = <-mch:
+			case <-time.After(time.Second):
+				t.Fatal("Did not receive message")
+			}
+		}
+		if last != "19" {
+			t.Fatalf("Expected last message to be 19, got %s", last)
+		}
+	})
+
+	t.Run("conflate", func(t *testing.T) {
+		bch := make(chan struct{})
+		var mu sync.Mutex
+		latest := make(map[string]string)
+		received := 0
+		sub, err := nc.Subscribe("price.*", func(m *nats.Msg) {
+			<-bch
+			mu.Lock()
+			latest[m.Subject] = string(m.Data)
+			received++
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+		sub.SetPendingLimits(5, -1)
+		sub.SetOverflowPolicy(nats.OverflowConflate)
+		for i := 0; i < 10; i++ {
+			for _, subj := range []string{"price.a", "price.b", "price.c"} {
+				nc.Publish(subj, []byte(fmt.Sprintf("%d", i)))
+			}
+		}
+		nc.Flush()
+		close(bch)
+		checkFor(t, time.Second, 15*time.Millisecond, func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, subj := range []string{"price.a", "price.b", "price.c"} {
+				if latest[subj] != "9" {
+					return fmt.Errorf("Expected latest of %s to be 9, got %q", subj, latest[subj])
+				}
+			}
+			return nil
+		})
+		stats, _ := sub.OverflowStats()
+		mu.Lock()
+		defer mu.Unlock()
+		if stats.Conflated == 0 || received+int(stats.Conflated) != 30 {
+			t.Fatalf("Unexpected stats: %+v, received %d", stats, received)
+		}
+	})
+
+	t.Run("conflate under limits", func(t *testing.T) {
+		bch := make(chan struct{})
+		mch := make(chan string, 10)
+		sub, err := nc.Subscribe("under", func(m *nats.Msg) {
+			<-bch
+			mch <- string(m.Data)
+		})
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+		sub.SetPendingLimits(5, -1)
+		sub.SetOverflowPolicy(nats.OverflowConflate)
+		for i := 0; i < 3; i++ {
+			nc.Publish("under", []byte(fmt.Sprintf("%d", i)))
+		}
+		nc.Flush()
+		close(bch)
+		for i := 0; i < 3; i++ {
+			select {
+			case data := <-mch:
+				if data != fmt.Sprintf("%d", i) {
+					t.Fatalf("Expected %d, got %s", i, data)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Did not receive message %d", i)
+			}
+		}
+		if stats, _ := sub.OverflowStats(); stats.Conflated != 0 {
+			t.Fatalf("Unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		bch := make(chan struct{})
+		mch := make(chan *nats.Msg, 100)
+		sub, err := nc.Subscribe("spill", func(m *nats.Msg) {
+			<-bch
+			mch <- m
+		})
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+		sub.SetPendingLimits(2, -1)
+		if err := sub.SetOverflowSpill(t.TempDir(), -1); err != nil {
+			t.Fatalf("Error setting policy: %v", err)
+		}
+		for i := 0; i < 100; i++ {
+			m := nats.NewMsg("spill")
+			m.Header.Set("Seq", fmt.Sprintf("%d", i))
+			m.Data = []byte(fmt.Sprintf("%d", i))
+			nc.PublishMsg(m)
+		}
+		nc.Flush()
+		stats, _ := sub.OverflowStats()
+		if stats.Spilled == 0 || stats.SpillPending == 0 {
+			t.Fatalf("Unexpected stats: %+v", stats)
+		}
+		close(bch)
+		for i := 0; i < 100; i++ {
+			select {
+			case m := <-mch:
+				if string(m.Data) != fmt.Sprintf("%d", i) || m.Header.Get("Seq") != string(m.Data) {
+					t.Fatalf("Unexpected message %d: %q %v", i, m.Data, m.Header)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Did not receive message %d", i)
+			}
+		}
+		stats, _ = sub.OverflowStats()
+		if stats.SpillPending != 0 || stats.DroppedNewest != 0 || stats.SpillDropped != 0 {
+			t.Fatalf("Unexpected stats: %+v", stats)
+		}
+	})
+
+	t.Run("spill full", func(t *testing.T) {
+		bch := make(chan struct{})
+		sub, err := nc.Subscribe("full", func(m *nats.Msg) {
+			<-bch
+		})
+		if err != nil {
+			t.Fatalf("Error on subscribe: %v", err)
+		}
+		defer sub.Unsubscribe()
+		defer close(bch)
+		sub.SetPendingLimits(2, -1)
+		sub.SetOverflowSpill(t.TempDir(), 256)
+		for i := 0; i < 100; i++ {
+			nc.Publish("full", []byte("hello"))
+		}
+		nc.Flush()
+		stats, _ := sub.OverflowStats()
+		if stats.Spilled == 0 || stats.SpillDropped == 0 || stats.DroppedNewest != 0 {
+			t.Fatalf("Unexpected stats: %+v", stats)
+		}
+		if nc.LastError() != nats.ErrSlowConsumer {
+			t.Fatalf("Expected LastError to indicate slow consumer, got %v", nc.LastError())
+		}
+	})
+}
+
+func TestPooledMsgs(t *testing.T) {
+	s := RunDefaultServer()
+	defer s.Shutdown()
+
+	nc, err := nats.Connect(nats.DefaultURL, nats.PooledMsgs())
+	if err != nil {
+		t.Fatalf("Error on connect: %v", err)
+	}
+	defer nc.Close()
+
+	total := 100
+	errCh := make(chan error, total)
+	done := make(chan bool, 1)
+	count := 0
+	if _, err := nc.Subscribe("foo.*", func(m *nats.Msg) {
+		count++
+		expected := fmt.Sprintf("msg-%d", count)
+		if string(m.Data) != expected || m.Subject != fmt.Sprintf("foo.%d", count%3) ||
+			m.Header.Get("Seq") != expected {
+			errCh <- fmt.Errorf("Unexpected message %q on %q, header %v", m.Data, m.Subject, m.Header)
+		}
+		m.Release()
+		if count == total {
+			done <- true
+		}
+	}); err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	for i := 1; i <= total; i++ {
+		m := nats.NewMsg(fmt.Sprintf("foo.%d", i%3))
+		m.Data = []byte(fmt.Sprintf("msg-%d", i))
+		m.Header.Set("Seq", string(m.Data))
+		if err := nc.PublishMsg(m); err != nil {
+			t.Fatalf("Error on publish: %v", err)
+		}
+	}
+	if err := Wait(done); err != nil {
+		t.Fatal("Did not receive all messages")
+	}
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	default:
+	}
+
+	// Messages that are not released remain valid.
+	sub, err := nc.SubscribeSync("bar")
+	if err != nil {
+		t.Fatalf("Error on subscribe: %v", err)
+	}
+	nc.Publish("bar", []byte("first"))
+	nc.Publish("bar", []byte("second"))
+	first, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Error on next msg: %v", err)
+	}
+	second, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatalf("Error on next msg: %v", err)
+	}
+	if string(first.Data) != "first" || string(second.Data) != "second" {
+		t.Fatalf("Unexpected messages %q and %q", first.Data, second.Data)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2022 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// ValueTransformer transforms the values written to and read from KeyValue
+// and ObjectStore buckets, for instance to compress or encrypt them.
+// A transformer records what it did in the message headers when encoding,
+// and uses those headers to reverse the transformation when decoding.
+//
+// The key identifies the value within its bucket: the key of a KeyValue
+// entry, or the chunk subject of an object. It allows transformers to bind
+// the transformed data to the value it belongs to. The key of a KeyValue
+// entry is used rather than its subject, since the subject changes when
+// the entry is sourced into another bucket.
+//
+// Notice: Experimental Preview
+//
+// This functionality is EXPERIMENTAL and may be changed in later releases.
+type ValueTransformer interface {
+	// Encode transforms the data and sets the headers describing the transformation.
+	Encode(key string, hdr Header, data []byte) ([]byte, error)
+	// Decode reverses the transformation described by the headers, and removes
+	// those headers. Data that was not transformed by this transformer must
+	// be returned as is.
+	Decode(key string, hdr Header, data []byte) ([]byte, error)
+}
+
+// limitedDecoder is implemented by the transformers that can expand the
+// data, so that decoding stops as soon as the data exceeds max bytes.
+type limitedDecoder interface {
+	decodeLimited(key string, hdr Header, data []byte, max int64) ([]byte, error)
+}
+
+// Headers used by the builtin value transformers.
+const (
+	ValueCompressionHdr   = "Nats-Value-Compression"
+	ValueEncryptionHdr    = "Nats-Value-Encryption"
+	ValueEncryptionKeyHdr = "Nats-Value-Encryption-Key"
+)
+
+const (
+	valueGzip   = "gzip"
+	valueS2     = "s2"
+	valueAESGCM = "AES-GCM"
+)
+
+var (
+	ErrValueTransformMissing = errors.New("nats: no value transformer to decode the value")
+	ErrValueKeyNotFound      = errors.New("nats: value encryption key not found")
+	ErrValueKeyIDRequired    = errors.New("nats: value encryption key id required")
+	ErrValueTooLarge         = errors.New("nats: value exceeds the maximum value size")
+)
+
+// KeyValueWithTransforms returns a handle to the same bucket that applies the
+// transforms, in order, to the values written, and in reverse order to the
+// values read. Values written without transforms are still readable.
+// The bucket's MaxValueSize, or the maximum payload of the server if the
+// bucket has none, applies to the values before they are transformed, so
+// that a decompressed value can never exceed it.
+func KeyValueWithTransforms(kv KeyValue, transforms ...ValueTransformer) (KeyValue, error) {
+	kvh, ok := kv.(*kvs)
+	if !ok {
+		return nil, errors.New("nats: key-value malformed")
+	}
+	nkv := *kvh
+	nkv.transforms = append(append([]ValueTransformer(nil), kvh.transforms...), transforms...)
+	return &nkv, nil
+}
+
+// ObjectStoreWithTransforms returns a handle to the same object store that
+// applies the transforms, in order, to each chunk written, and in reverse
+// order to each chunk read. The object size and digest are those of the
+// original data. A decoded chunk can not exceed the chunk size of its object.
+func ObjectStoreWithTransforms(store ObjectStore, transforms ...ValueTransformer) (ObjectStore, error) {
+	ob, ok := store.(*obs)
+	if !ok {
+		return nil, errors.New("nats: object-store malformed")
+	}
+	nob := *ob
+	nob.transforms = append(append([]ValueTransformer(nil), ob.transforms...), transforms...)
+	return &nob, nil
+}
+
+// encodeValue applies the transforms to the message data.
+func encodeValue(transforms []ValueTransformer, key string, m *Msg) error {
+	if len(transforms) == 0 {
+		return nil
+	}
+	if m.Header == nil {
+		m.Header = Header{}
+	}
+	data := m.Data
+	for _, t := range transforms {
+		var err error
+		if data, err = t.Encode(key, m.Header, data); err != nil {
+			return err
+		}
+	}
+	m.Data = data
+	return nil
+}
+
+// decodeValue reverses the transforms described in the headers, failing
+// with ErrValueTooLarge if the decoded data would exceed max bytes.
+// The headers are modified in place.
+func decodeValue(transforms []ValueTransformer, key string, max int64, hdr Header, data []byte) ([]byte, error) {
+	if len(hdr) == 0 {
+		return data, nil
+	}
+	for i := len(transforms) - 1; i >= 0; i-- {
+		var err error
+		if ld, ok := transforms[i].(limitedDecoder); ok {
+			data, err = ld.decodeLimited(key, hdr, data, max)
+		} else {
+			data, err = transforms[i].Decode(key, hdr, data)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Make sure we are not handing out a value we could not decode.
+	if hdr.Get(ValueCompressionHdr) != _EMPTY_ || hdr.Get(ValueEncryptionHdr) != _EMPTY_ {
+		return nil, ErrValueTransformMissing
+	}
+	return data, nil
+}
+
+// GzipCompression returns a ValueTransformer that compresses values with gzip.
+func GzipCompression() ValueTransformer {
+	return gzipTransform{}
+}
+
+type gzipTransform struct{}
+
+func (gzipTransform) Encode(_ string, hdr Header, data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	hdr.Set(ValueCompressionHdr, valueGzip)
+	return b.Bytes(), nil
+}
+
+func (t gzipTransform) Decode(key string, hdr Header, data []byte) ([]byte, error) {
+	return t.decodeLimited(key, hdr, data, 0)
+}
+
+func (gzipTransform) decodeLimited(_ string, hdr Header, data []byte, max int64) ([]byte, error) {
+	if hdr.Get(ValueCompressionHdr) != valueGzip {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var r io.Reader = zr
+	if max > 0 {
+		// Read one more byte than allowed to detect values that are too large.
+		r = io.LimitReader(zr, max+1)
+	}
+	data, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && int64(len(data)) > max {
+		return nil, ErrValueTooLarge
+	}
+	hdr.Del(ValueCompressionHdr)
+	return data, nil
+}
+
+// S2Compression returns a ValueTransformer that compresses values with S2,
+// which is much faster than gzip at the cost of a lower compression ratio.
+func S2Compression() ValueTransformer {
+	return s2Transform{}
+}
+
+type s2Transform struct{}
+
+func (s2Transform) Encode(_ string, hdr Header, data []byte) ([]byte, error) {
+	hdr.Set(ValueCompressionHdr, valueS2)
+	return s2.Encode(nil, data), nil
+}
+
+func (t s2Transform) Decode(key string, hdr Header, data []byte) ([]byte, error) {
+	return t.decodeLimited(key, hdr, data, 0)
+}
+
+func (s2Transform) decodeLimited(_ string, hdr Header, data []byte, max int64) ([]byte, error) {
+	if hdr.Get(ValueCompressionHdr) != valueS2 {
+		return data, nil
+	}
+	// The decoded length is known upfront, check it before allocating.
+	n, err := s2.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && int64(n) > max {
+		return nil, ErrValueTooLarge
+	}
+	if data, err = s2.Decode(nil, data); err != nil {
+		return nil, err
+	}
+	hdr.Del(ValueCompressionHdr)
+	return data, nil
+}
+
+// AESGCMEncryption returns a ValueTransformer that encrypts values with
+// AES-GCM using the key identified by keyID. The key id is recorded in the
+// headers, so that values encrypted with any of the given keys can be
+// decrypted, which allows keys to be rotated. Keys must be 16, 24 or 32
+// bytes long. The key of the value is authenticated along with the data, so
+// that an encrypted value can not be moved to another key.
+func AESGCMEncryption(keyID string, keys map[string][]byte) (ValueTransformer, error) {
+	if keyID == _EMPTY_ {
+		return nil, ErrValueKeyIDRequired
+	}
+	t := &aesTransform{keyID: keyID, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("nats: invalid key %q: %v", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		t.aeads[id] = aead
+	}
+	if _, ok := t.aeads[keyID]; !ok {
+		return nil, ErrValueKeyNotFound
+	}
+	return t, nil
+}
+
+type aesTransform struct {
+	keyID string
+	aeads map[string]cipher.AEAD
+}
+
+func (t *aesTransform) Encode(key string, hdr Header, data []byte) ([]byte, error) {
+	aead := t.aeads[t.keyID]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	hdr.Set(ValueEncryptionHdr, valueAESGCM)
+	hdr.Set(ValueEncryptionKeyHdr, t.keyID)
+	return aead.Seal(nonce, nonce, data, []byte(key)), nil
+}
+
+func (t *aesTransform) Decode(key string, hdr Header, data []byte) ([]byte, error) {
+	if hdr.Get(ValueEncryptionHdr) != valueAESGCM {
+		return data, nil
+	}
+	aead, ok := t.aeads[hdr.Get(ValueEncryptionKeyHdr)]
+	if !ok {
+		return nil, ErrValueKeyNotFound
+	}
+	ns := aead.NonceSize()
+	if len(data) < ns {
+		return nil, errors.New("nats: encrypted value too short")
+	}
+	data, err := aead.Open(nil, data[:ns], data[ns:], []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	hdr.Del(ValueEncryptionHdr)
+	hdr.Del(ValueEncryptionKeyHdr)
+	return data, nil
+}